@@ -534,6 +534,7 @@ func generateInteractive(cmd *cobra.Command, model string) error {
 	if err != nil {
 		return err
 	}
+	defer scanner.Close()
 
 	var wordWrap bool
 	termType := os.Getenv("TERM")
@@ -550,8 +551,7 @@ func generateInteractive(cmd *cobra.Command, model string) error {
 		wordWrap = false
 	}
 
-	fmt.Print(readline.StartBracketedPaste)
-	defer fmt.Printf(readline.EndBracketedPaste)
+	scanner.Terminal.EnableBracketedPaste()
 
 	var multiLineBuffer string
 
@@ -0,0 +1,31 @@
+package readline
+
+import "unicode"
+
+// expand replaces the word that ends at the cursor with its abbreviation, if
+// it has one. Only whole words are expanded, so the word has to start the
+// line or follow a space and the cursor has to be at its end.
+func (b *Buffer) expand(abbrs map[string]string) bool {
+	if len(abbrs) == 0 || (b.Pos < b.Size() && !unicode.IsSpace(b.runeAt(b.Pos))) {
+		return false
+	}
+
+	start := b.Pos
+	for start > 0 && !unicode.IsSpace(b.runeAt(start-1)) {
+		start -= 1
+	}
+	if start == b.Pos {
+		return false
+	}
+
+	expansion, ok := abbrs[b.StringNM(start, b.Pos)]
+	if !ok || !b.fits(b.Pos-start, len([]rune(expansion))) {
+		return false
+	}
+
+	// removed without drawing so the line is only redrawn once expanded
+	b.remove(start, b.Pos)
+	b.Pos = start
+	b.AddString(expansion)
+	return true
+}
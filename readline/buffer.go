@@ -2,12 +2,20 @@ package readline
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/emirpasic/gods/lists/arraylist"
+	"github.com/mattn/go-runewidth"
 	"golang.org/x/term"
 )
 
+// Buffer holds the line being edited and keeps the terminal in step with it.
+// Each method that changes the line or moves the cursor redraws as little as
+// it can, so a Buffer can be driven from a custom input loop.
 type Buffer struct {
 	Pos       int
 	Buf       *arraylist.List
@@ -15,127 +23,180 @@ type Buffer struct {
 	LineWidth int
 	Width     int
 	Height    int
+
+	out io.Writer
+
+	// suggestion is shown in grey after the end of the line
+	suggestion string
+
+	// where the terminal cursor is, relative to the start of the input
+	row  int
+	col  int
+	rows int // last row drawn
+	menu bool
+
+	// what was drawn last time, so that only what's changed is drawn again
+	drawn       []rune
+	drawnPrompt string
+	endCol      int // where the last row drawn ends
+
+	// HorizontalScroll scrolls a line that's too long for the row sideways
+	// instead of wrapping it. Lines with newlines are always wrapped.
+	HorizontalScroll bool
+
+	scrolled bool
+	offset   int // first rune shown while scrolled
+
+	// MaskRune is drawn in place of masked runes
+	MaskRune rune
+
+	// Colors are used for the suggestion, the placeholder and the status
+	Colors     Colors
+	color      bool
+	colorDepth colorDepth
+
+	// CaretNotation draws control characters as ^ and a letter, such as ^A,
+	// rather than writing them to the terminal as they are
+	CaretNotation bool
+
+	// UnicodeWords finds words by script and punctuation rather than only
+	// by spaces
+	UnicodeWords bool
+
+	// ShellIntegration puts the OSC 133 marks around the prompt whenever
+	// it's drawn again
+	ShellIntegration bool
+
+	// MaxLength is the most runes the line can have, or 0 for no limit.
+	// Whatever would be inserted past it is dropped.
+	MaxLength int
+
+	masked    bool
+	maskStart int
+	maskEnd   int
+	maskAll   bool // for Instance.Mask, which lasts however the line changes
+
+	// the history entry the line was recalled from, until it's edited
+	recalled     bool
+	recalledFrom int
+}
+
+// position is a location on screen relative to the start of the input.
+// Columns don't include the prompt.
+type position struct {
+	row int
+	col int
 }
 
+// NewBuffer returns an empty buffer which wraps lines to the width of the
+// terminal on stdout, or 80 columns if it isn't a terminal. The prompt is
+// expected to have been printed already and the buffer writes to stdout
+// unless SetOutput is called.
 func NewBuffer(prompt *Prompt) (*Buffer, error) {
 	fd := int(os.Stdout.Fd())
 	width, height, err := term.GetSize(fd)
 	if err != nil {
-		fmt.Println("Error getting size:", err)
-		return nil, err
+		// stdout isn't a terminal so fall back to a typical size
+		width, height = 80, 24
 	}
 
-	lwidth := width - len(prompt.Prompt)
-	if prompt.UseAlt {
-		lwidth = width - len(prompt.AltPrompt)
-	}
+	lwidth := width - prompt.Width()
 
 	b := &Buffer{
 		Pos:       0,
 		Buf:       arraylist.New(),
+		out:       os.Stdout,
 		Prompt:    prompt,
 		Width:     width,
 		Height:    height,
 		LineWidth: lwidth,
 	}
+	// the prompt is printed before the buffer is used
+	b.drawnPrompt = b.prompts()
 
 	return b, nil
 }
 
+// SetOutput sets where the buffer draws itself.
+func (b *Buffer) SetOutput(w io.Writer) {
+	b.out = w
+}
+
 func (b *Buffer) MoveLeft() {
 	if b.Pos > 0 {
-		if b.Pos%b.LineWidth == 0 {
-			fmt.Printf(CursorUp + CursorBOL + cursorRightN(b.Width))
-		} else {
-			fmt.Print(CursorLeft)
-		}
-		b.Pos -= 1
+		b.Pos = b.clusterStart(b.Pos - 1)
+		b.moveTo(b.positions()[b.Pos])
 	}
 }
 
 func (b *Buffer) MoveLeftWord() {
 	if b.Pos > 0 {
-		var foundNonspace bool
-		for {
-			v, _ := b.Buf.Get(b.Pos - 1)
-			if v == ' ' {
-				if foundNonspace {
-					break
-				}
-			} else {
-				foundNonspace = true
-			}
-			b.MoveLeft()
-
-			if b.Pos == 0 {
-				break
-			}
-		}
+		b.Pos = b.prevWord(1)
+		b.moveTo(b.positions()[b.Pos])
 	}
 }
 
 func (b *Buffer) MoveRight() {
 	if b.Pos < b.Size() {
-		b.Pos += 1
-		if b.Pos%b.LineWidth == 0 {
-			fmt.Printf(CursorDown + CursorBOL + cursorRightN(b.PromptSize()))
-		} else {
-			fmt.Print(CursorRight)
-		}
+		b.Pos = b.clusterEnd(b.Pos)
+		b.moveTo(b.positions()[b.Pos])
 	}
 }
 
 func (b *Buffer) MoveRightWord() {
 	if b.Pos < b.Size() {
-		for {
-			b.MoveRight()
-			v, _ := b.Buf.Get(b.Pos)
-			if v == ' ' {
-				break
-			}
-
-			if b.Pos == b.Size() {
-				break
+		var pos int
+		if b.UnicodeWords {
+			pos = b.nextWord(1)
+		} else {
+			pos = b.Pos + 1
+			for pos < b.Size() && !unicode.IsSpace(b.runeAt(pos)) {
+				pos += 1
 			}
 		}
+		b.Pos = pos
+		b.moveTo(b.positions()[b.Pos])
 	}
 }
 
 func (b *Buffer) MoveToStart() {
 	if b.Pos > 0 {
-		currLine := b.Pos / b.LineWidth
-		if currLine > 0 {
-			for cnt := 0; cnt < currLine; cnt++ {
-				fmt.Print(CursorUp)
-			}
-		}
-		fmt.Printf(CursorBOL + cursorRightN(b.PromptSize()))
 		b.Pos = 0
+		b.moveTo(position{})
 	}
 }
 
 func (b *Buffer) MoveToEnd() {
 	if b.Pos < b.Size() {
-		currLine := b.Pos / b.LineWidth
-		totalLines := b.Size() / b.LineWidth
-		if currLine < totalLines {
-			for cnt := 0; cnt < totalLines-currLine; cnt++ {
-				fmt.Print(CursorDown)
-			}
-			remainder := b.Size() % b.LineWidth
-			fmt.Printf(CursorBOL + cursorRightN(b.PromptSize()+remainder))
-		} else {
-			fmt.Print(cursorRightN(b.Size() - b.Pos))
-		}
-
 		b.Pos = b.Size()
+		b.moveTo(b.positions()[b.Pos])
 	}
 }
 
+// RenderedRows returns how many rows of the terminal the prompt and the line
+// take up, counting rows that have wrapped and ones after a newline.
+func (b *Buffer) RenderedRows() int {
+	if b.scrolling() {
+		return 1
+	}
+	return b.positions()[b.Size()].row + 1
+}
+
+// Size returns the number of runes in the buffer.
 func (b *Buffer) Size() int {
 	return b.Buf.Size()
 }
 
+// ByteLen returns the length in bytes of the buffer's contents once UTF-8
+// encoded, which is len(b.String()).
+func (b *Buffer) ByteLen() int {
+	var n int
+	for cnt := 0; cnt < b.Size(); cnt++ {
+		n += utf8.RuneLen(b.runeAt(cnt))
+	}
+	return n
+}
+
 func min(n, m int) int {
 	if n > m {
 		return m
@@ -143,183 +204,508 @@ func min(n, m int) int {
 	return n
 }
 
+// PromptSize returns the width of the prompt on screen.
 func (b *Buffer) PromptSize() int {
-	if b.Prompt.UseAlt {
-		return len(b.Prompt.AltPrompt)
+	return b.Prompt.Width()
+}
+
+func (b *Buffer) prompt() string {
+	if b.ShellIntegration {
+		return PromptStart + b.Prompt.first() + PromptEnd
 	}
-	return len(b.Prompt.Prompt)
+	return b.Prompt.first()
+}
+
+// prompts identifies both prompts as they were drawn.
+func (b *Buffer) prompts() string {
+	return b.Prompt.first() + "\n" + b.Prompt.continuation()
 }
 
 func (b *Buffer) Add(r rune) {
+	if b.room(1) == 0 {
+		return
+	}
 	if b.Pos == b.Buf.Size() {
-		fmt.Printf("%c", r)
 		b.Buf.Add(r)
-		b.Pos += 1
-		if b.Pos > 0 && b.Pos%b.LineWidth == 0 {
-			fmt.Printf("\n%s", b.Prompt.AltPrompt)
-		}
 	} else {
-		fmt.Printf("%c", r)
 		b.Buf.Insert(b.Pos, r)
-		b.Pos += 1
-		if b.Pos > 0 && b.Pos%b.LineWidth == 0 {
-			fmt.Printf("\n%s", b.Prompt.AltPrompt)
-		}
-		b.drawRemaining()
 	}
+	b.inserted(b.Pos, 1)
+	b.recalled = false
+	b.Pos += 1
+	b.draw()
 }
 
-func (b *Buffer) drawRemaining() {
-	var place int
-	remainingText := b.StringN(b.Pos)
-	if b.Pos > 0 {
-		place = b.Pos % b.LineWidth
+// AddString inserts s at the cursor, redrawing the line once.
+func (b *Buffer) AddString(s string) {
+	if s == "" {
+		return
 	}
-	fmt.Print(CursorHide)
 
-	// render the rest of the current line
-	currLine := remainingText[:min(b.LineWidth-place, len(remainingText))]
-	if len(currLine) > 0 {
-		fmt.Printf(ClearToEOL + currLine)
-		fmt.Print(cursorLeftN(len(currLine)))
+	// inserted all at once so the rest of the line only moves along once
+	var values []interface{}
+	for _, r := range s {
+		values = append(values, r)
+	}
+	values = values[:b.room(len(values))]
+	if len(values) == 0 {
+		return
+	}
+
+	start := b.Pos
+	if b.Pos == b.Buf.Size() {
+		b.Buf.Add(values...)
 	} else {
-		fmt.Print(ClearToEOL)
+		b.Buf.Insert(b.Pos, values...)
+	}
+	b.Pos += len(values)
+	b.inserted(start, len(values))
+	b.recalled = false
+	b.draw()
+}
+
+// setSuggestion changes the suggestion shown after the end of the line.
+func (b *Buffer) setSuggestion(s string) {
+	if s != b.suggestion {
+		b.suggestion = s
+		b.draw()
+	}
+}
+
+// AcceptSuggestion adds the suggestion to the end of the line.
+func (b *Buffer) AcceptSuggestion() bool {
+	if b.suggestion == "" {
+		return false
+	}
+
+	s := b.suggestion
+	b.suggestion = ""
+	b.MoveToEnd()
+	b.AddString(s)
+	return true
+}
+
+// room returns how many of n runes can be inserted without going past
+// MaxLength.
+func (b *Buffer) room(n int) int {
+	if b.MaxLength <= 0 {
+		return n
 	}
+	return max(min(n, b.MaxLength-b.Size()), 0)
+}
 
-	// render the other lines
-	if len(remainingText) > len(currLine) {
-		remaining := []rune(remainingText[len(currLine):])
-		var totalLines int
-		for i, c := range remaining {
-			if i%b.LineWidth == 0 {
-				fmt.Printf("\n%s", b.Prompt.AltPrompt)
-				totalLines += 1
+// fits reports whether replacing remove runes with add runes keeps the line
+// within MaxLength.
+func (b *Buffer) fits(remove, add int) bool {
+	return b.MaxLength <= 0 || b.Size()-remove+add <= b.MaxLength
+}
+
+func (b *Buffer) runeAt(n int) rune {
+	v, _ := b.Buf.Get(n)
+	r, _ := v.(rune)
+	return r
+}
+
+// positions returns the screen position of each rune in the buffer, followed
+// by the position just past the end. Lines wrap at LineWidth and as soon as a
+// line is full, so the cursor is never left past the last column, but never
+// within a grapheme cluster.
+func (b *Buffer) positions() []position {
+	return b.place(b.widths())
+}
+
+// place is positions with the widths already worked out.
+func (b *Buffer) place(widths []int, joined []bool) []position {
+	pos := make([]position, b.Size()+1)
+
+	var row, col int
+	var wrapped bool
+	for cnt := 0; cnt < b.Size(); cnt++ {
+		r := b.shown(cnt)
+		if r == '\n' {
+			pos[cnt] = position{row, col}
+			// a newline straight after a full line doesn't need another row
+			if !wrapped {
+				row, col = row+1, 0
 			}
-			fmt.Printf("%c", c)
+			wrapped = false
+			continue
+		}
+
+		w := widths[cnt]
+		if col+w > b.LineWidth {
+			row, col = row+1, 0
+		}
+		pos[cnt] = position{row, col}
+
+		col += w
+		if cnt+1 < b.Size() && joined[cnt+1] {
+			continue
+		}
+		wrapped = col >= b.LineWidth
+		if wrapped {
+			row, col = row+1, 0
 		}
-		fmt.Print(ClearToEOL)
-		fmt.Print(cursorUpN(totalLines))
-		fmt.Printf(CursorBOL + cursorRightN(b.Width-len(currLine)))
 	}
+	pos[b.Size()] = position{row, col}
 
-	fmt.Print(CursorShow)
+	return pos
 }
 
-func (b *Buffer) Remove() {
-	if b.Buf.Size() > 0 && b.Pos > 0 {
-		if b.Pos%b.LineWidth == 0 {
-			// if the user backspaces over the word boundary, do this magic to clear the line
-			// and move to the end of the previous line
-			fmt.Printf(CursorBOL + ClearToEOL)
-			fmt.Printf(CursorUp + CursorBOL + cursorRightN(b.Width) + " " + CursorLeft)
-		} else {
-			fmt.Printf(CursorLeft + " " + CursorLeft)
+// moveTo moves the terminal cursor to p.
+func (b *Buffer) moveTo(p position) {
+	if b.scrolled {
+		b.drawScrolled()
+		return
+	}
+	fmt.Fprint(b.out, b.cursorTo(p))
+}
+
+func (b *Buffer) cursorTo(p position) string {
+	var s string
+	switch {
+	case p.row < b.row:
+		s = cursorUpN(b.row-p.row) + CursorBOL + cursorRightN(b.prefixSize(p.row)+p.col)
+	case p.row > b.row:
+		s = cursorDownN(p.row-b.row) + CursorBOL + cursorRightN(b.prefixSize(p.row)+p.col)
+	case p.col < b.col:
+		s = cursorLeftN(b.col - p.col)
+	case p.col > b.col:
+		s = cursorRightN(p.col - b.col)
+	}
+
+	b.row, b.col = p.row, p.col
+	return s
+}
+
+// prefixSize is the width of the prompt shown in front of the given row.
+func (b *Buffer) prefixSize(row int) int {
+	if row == 0 {
+		return b.PromptSize()
+	}
+	return b.Prompt.ContinuationWidth()
+}
+
+// draw redraws the buffer from the first rune that's changed since it was
+// last drawn, clears anything left over from before, and puts the cursor
+// back at Pos.
+func (b *Buffer) draw() {
+	if b.scrolling() {
+		b.drawScrolled()
+		return
+	}
+
+	// the line fits again so draw all of it normally
+	b.scrolled, b.offset = false, 0
+
+	// drawn from the start of a grapheme cluster since what's been added
+	// can join what was already there
+	n := b.clusterStart(b.unchanged())
+	if b.prompts() != b.drawnPrompt {
+		n = 0
+	}
+
+	var sb strings.Builder
+
+	widths, joined := b.widths()
+	pos := b.place(widths, joined)
+	remaining := b.Pos < b.Size()
+	if remaining {
+		sb.WriteString(CursorHide)
+	}
+
+	if n == 0 && b.prompts() != b.drawnPrompt {
+		sb.WriteString(cursorUpN(b.row) + CursorBOL + b.prompt())
+		b.row, b.col = 0, 0
+		b.drawnPrompt = b.prompts()
+	} else if n == 0 {
+		sb.WriteString(b.cursorTo(position{}))
+	} else {
+		// start at the end of the previous rune rather than at pos[n] in case
+		// a wide rune at n has been moved onto the next row
+		start := pos[n-1]
+		if r := b.shown(n - 1); r != '\n' {
+			start.col += widths[n-1]
+			if start.col >= b.LineWidth {
+				start = position{start.row + 1, 0}
+			}
 		}
+		sb.WriteString(b.cursorTo(start))
+	}
+
+	newline := func() {
+		sb.WriteString(ClearToEOL + "\r\n" + b.Prompt.continuation())
+		b.row, b.col = b.row+1, 0
+	}
 
-		var eraseExtraLine bool
-		if (b.Size()-1)%b.LineWidth == 0 {
-			eraseExtraLine = true
+	for cnt := n; cnt < b.Size(); cnt++ {
+		for b.row < pos[cnt].row {
+			newline()
 		}
 
-		b.Pos -= 1
-		b.Buf.Remove(b.Pos)
-
-		if b.Pos < b.Size() {
-			b.drawRemaining()
-			// this erases a line which is left over when backspacing in the middle of a line and there
-			// are trailing characters which go over the line width boundary
-			if eraseExtraLine {
-				remainingLines := (b.Size() - b.Pos) / b.LineWidth
-				fmt.Printf(cursorDownN(remainingLines+1) + CursorBOL + ClearToEOL)
-				place := b.Pos % b.LineWidth
-				fmt.Printf(cursorUpN(remainingLines+1) + cursorRightN(place+len(b.Prompt.Prompt)))
+		r := b.shown(cnt)
+		if r == '\n' {
+			continue
+		}
+
+		sb.WriteString(b.glyph(r))
+		b.col += widths[cnt]
+		if b.col >= b.LineWidth && (cnt+1 == b.Size() || !joined[cnt+1]) {
+			sb.WriteString("\r\n" + b.Prompt.continuation())
+			b.row, b.col = b.row+1, 0
+		}
+	}
+
+	end := pos[b.Size()]
+	for b.row < end.row {
+		newline()
+	}
+
+	if b.suggestion != "" {
+		// only show as much as fits on the row
+		var suggestion []rune
+		for _, r := range b.suggestion {
+			w := runewidth.RuneWidth(r)
+			if r == '\n' || b.col+w >= b.LineWidth {
+				break
 			}
+			suggestion = append(suggestion, r)
+			b.col += w
+		}
+		sb.WriteString(b.paint(b.Colors.Suggestion, string(suggestion)))
+	}
+	sb.WriteString(b.clearRest())
+	b.drawn = b.drawn[:0]
+	for cnt := 0; cnt < b.Size(); cnt++ {
+		b.drawn = append(b.drawn, b.shown(cnt))
+	}
+
+	sb.WriteString(b.cursorTo(pos[b.Pos]))
+	if remaining {
+		sb.WriteString(CursorShow)
+	}
+
+	fmt.Fprint(b.out, sb.String())
+}
+
+// clearRest clears whatever was drawn past the cursor last time, to the end
+// of the row or, if more rows were drawn, to the end of the screen. It's
+// called with the cursor just past the end of the line.
+func (b *Buffer) clearRest() string {
+	var clear string
+	switch {
+	case b.menu, b.rows > b.row:
+		clear = ClearToEOS
+	case b.rows < b.row, b.endCol > b.col:
+		clear = ClearToEOL
+	}
+	b.rows, b.endCol = b.row, b.col
+	b.menu = false
+	return clear
+}
+
+// unchanged returns how many runes at the start of the line are shown just
+// as they were last drawn.
+func (b *Buffer) unchanged() int {
+	n := min(len(b.drawn), b.Size())
+	for cnt := 0; cnt < n; cnt++ {
+		if b.drawn[cnt] != b.shown(cnt) {
+			return cnt
+		}
+	}
+	return n
+}
+
+// showMenu lists the candidates on the rows below the line until the next
+// time it's drawn.
+func (b *Buffer) showMenu(candidates []Completion) {
+	var sb strings.Builder
+	var rows, col int
+	for idx, candidate := range candidates {
+		c := runewidth.Truncate(candidate.Text, b.Width-1, "")
+		w := runewidth.StringWidth(c)
+		if idx == 0 || col+2+w >= b.Width {
+			sb.WriteString(ClearToEOL + "\r\n")
+			rows, col = rows+1, 0
+		} else {
+			sb.WriteString("  ")
+			col += 2
 		}
+		sb.WriteString(c)
+		col += w
+	}
+	b.showBelow(sb.String(), rows)
+}
+
+// showStatus shows msg on the row under the input, in place of the menu if
+// there is one, until the next key.
+func (b *Buffer) showStatus(msg string) {
+	b.showBelow(ClearToEOL+"\r\n"+b.paint(b.Colors.Hint, runewidth.Truncate(msg, b.Width-1, "")), 1)
+}
+
+// showBelow draws text, which starts a new row for each of its rows, after
+// the input and puts the cursor back. It's cleared by the next draw.
+func (b *Buffer) showBelow(text string, rows int) {
+	var sb strings.Builder
+
+	pos := b.positions()
+	if b.scrolled {
+		line, _ := b.window()
+		sb.WriteString(CursorBOL + cursorRightN(b.PromptSize()+runewidth.StringWidth(line)))
+	} else {
+		sb.WriteString(b.cursorTo(pos[b.Size()]))
+	}
+
+	sb.WriteString(text)
+	sb.WriteString(ClearToEOS)
+
+	// cleared along with any other unused rows
+	b.row += rows
+	b.rows = b.row
+	b.menu = true
+	if b.scrolled {
+		sb.WriteString(cursorUpN(rows) + CursorBOL + cursorRightN(b.PromptSize()+b.col))
+		b.row = 0
+	} else {
+		sb.WriteString(b.cursorTo(pos[b.Pos]))
+	}
+
+	fmt.Fprint(b.out, sb.String())
+}
+
+// dismissMenu clears the completion menu, or the status, if it's being shown.
+func (b *Buffer) dismissMenu() {
+	if b.menu {
+		b.draw()
+	}
+}
+
+// redraw draws the prompt and the whole buffer again from the current row,
+// as if nothing had been drawn yet.
+func (b *Buffer) redraw() {
+	b.row, b.col, b.rows = 0, 0, 0
+	b.refresh()
+}
+
+// refresh draws the prompt and the whole buffer again over the rows it's on.
+func (b *Buffer) refresh() {
+	// what's on the rest of the row isn't known
+	b.endCol = b.LineWidth
+	b.drawn, b.drawnPrompt = nil, ""
+	b.draw()
+}
+
+// remove deletes the runes from start up to, but not including, end.
+func (b *Buffer) remove(start, end int) {
+	switch {
+	case end-start == 1:
+		b.Buf.Remove(start)
+	case start < end:
+		// rebuilt rather than removing one at a time, which moves the rest
+		// of the line along for every rune
+		values := b.Buf.Values()
+		b.Buf.Clear()
+		b.Buf.Add(values[:start]...)
+		b.Buf.Add(values[end:]...)
+	}
+	b.removed(start, end)
+	if start < end {
+		b.recalled = false
 	}
 }
 
+// Remove deletes the grapheme cluster before the cursor, which for most text
+// is one rune.
+func (b *Buffer) Remove() {
+	if b.Buf.Size() > 0 && b.Pos > 0 {
+		end := b.Pos
+		b.Pos = b.clusterStart(b.Pos - 1)
+		b.remove(b.Pos, end)
+		b.draw()
+	}
+}
+
+// Delete deletes the grapheme cluster at the cursor.
 func (b *Buffer) Delete() {
 	if b.Size() > 0 && b.Pos < b.Size() {
-		b.Buf.Remove(b.Pos)
-		b.drawRemaining()
-		if b.Size()%b.LineWidth == 0 {
-			if b.Pos != b.Size() {
-				remainingLines := (b.Size() - b.Pos) / b.LineWidth
-				fmt.Printf(cursorDownN(remainingLines) + CursorBOL + ClearToEOL)
-				place := b.Pos % b.LineWidth
-				fmt.Printf(cursorUpN(remainingLines) + cursorRightN(place+len(b.Prompt.Prompt)))
-			}
-		}
+		b.remove(b.Pos, b.clusterEnd(b.Pos))
+		b.draw()
 	}
 }
 
 func (b *Buffer) DeleteBefore() {
 	if b.Pos > 0 {
-		for cnt := b.Pos - 1; cnt >= 0; cnt-- {
-			b.Remove()
-		}
+		b.remove(0, b.Pos)
+		b.Pos = 0
+		b.draw()
 	}
 }
 
 func (b *Buffer) DeleteRemaining() {
 	if b.Size() > 0 && b.Pos < b.Size() {
-		charsToDel := b.Size() - b.Pos
-		for cnt := 0; cnt < charsToDel; cnt++ {
-			b.Delete()
-		}
+		b.remove(b.Pos, b.Size())
+		b.draw()
 	}
 }
 
+// Clear empties the line and moves the cursor to the start. The suggestion
+// goes too since it was for what the line had in it.
+func (b *Buffer) Clear() {
+	b.remove(0, b.Size())
+	b.Pos = 0
+	b.suggestion = ""
+	b.draw()
+}
+
 func (b *Buffer) DeleteWord() {
-	if b.Buf.Size() > 0 && b.Pos > 0 {
-		var foundNonspace bool
-		for {
-			v, _ := b.Buf.Get(b.Pos - 1)
-			if v == ' ' {
-				if !foundNonspace {
-					b.Remove()
-				} else {
-					break
-				}
-			} else {
-				foundNonspace = true
-				b.Remove()
-			}
+	b.cut(b.prevWord(1), b.Pos)
+}
 
-			if b.Pos == 0 {
-				break
-			}
-		}
+// cut removes the runes from start up to end, leaves the cursor at start and
+// returns what was removed.
+func (b *Buffer) cut(start, end int) []rune {
+	if start >= end {
+		return nil
 	}
+
+	text := make([]rune, 0, end-start)
+	for cnt := start; cnt < end; cnt++ {
+		text = append(text, b.runeAt(cnt))
+	}
+
+	b.remove(start, end)
+	b.Pos = start
+	b.draw()
+	return text
 }
 
 func (b *Buffer) ClearScreen() {
-	fmt.Printf(ClearScreen + CursorReset + b.Prompt.Prompt)
-	if b.IsEmpty() {
-		ph := b.Prompt.Placeholder
-		fmt.Printf(ColorGrey + ph + cursorLeftN(len(ph)) + ColorDefault)
+	b.clearScreen(false)
+}
+
+// clearScreen clears the visible screen, and the scrollback too if asked,
+// then redraws the line at the top.
+func (b *Buffer) clearScreen(scrollback bool) {
+	if scrollback {
+		fmt.Fprint(b.out, ClearScreen+ClearScrollback+CursorReset)
 	} else {
-		currPos := b.Pos
-		b.Pos = 0
-		b.drawRemaining()
-		fmt.Printf(CursorReset + cursorRightN(len(b.Prompt.Prompt)))
-		if currPos > 0 {
-			targetLine := currPos / b.LineWidth
-			if targetLine > 0 {
-				for cnt := 0; cnt < targetLine; cnt++ {
-					fmt.Print(CursorDown)
-				}
-			}
-			remainder := currPos % b.LineWidth
-			if remainder > 0 {
-				fmt.Print(cursorRightN(remainder))
-			}
-			if currPos%b.LineWidth == 0 {
-				fmt.Printf(CursorBOL + b.Prompt.AltPrompt)
-			}
-		}
-		b.Pos = currPos
+		fmt.Fprint(b.out, ClearScreen+CursorReset)
+	}
+	b.redraw()
+	if b.IsEmpty() && b.Prompt.PlaceholderMode == PlaceholderAlwaysWhenEmpty {
+		fmt.Fprint(b.out, b.placeholder())
+	}
+}
+
+// placeholder returns the prompt's placeholder in its colour, with the
+// cursor going back over the columns it takes up, or nothing at all when
+// the placeholder is empty.
+func (b *Buffer) placeholder() string {
+	ph := b.Prompt.placeholder()
+	if ph == "" {
+		return ""
 	}
+	return b.paint(b.Colors.Placeholder, ph+cursorLeftN(runewidth.StringWidth(ph)))
 }
 
 func (b *Buffer) IsEmpty() bool {
@@ -327,12 +713,37 @@ func (b *Buffer) IsEmpty() bool {
 }
 
 func (b *Buffer) Replace(r []rune) {
-	b.Pos = 0
-	b.Buf.Clear()
-	fmt.Printf(ClearLine + CursorBOL + b.Prompt.Prompt)
-	for _, c := range r {
-		b.Add(c)
+	b.setLine(r)
+	b.draw()
+}
+
+// setLine is Replace without drawing.
+func (b *Buffer) setLine(r []rune) {
+	if b.MaxLength > 0 && len(r) > b.MaxLength {
+		r = r[:b.MaxLength]
+	}
+	values := make([]interface{}, len(r))
+	for idx, c := range r {
+		values[idx] = c
 	}
+
+	b.Buf.Clear()
+	b.masked = false
+	b.recalled = false
+	b.Buf.Add(values...)
+	b.Pos = b.Size()
+}
+
+// recall replaces the line with the history entry at n.
+func (b *Buffer) recall(r []rune, n int) {
+	b.Replace(r)
+	b.recalled, b.recalledFrom = true, n
+}
+
+// FromHistory returns the index of the history entry the line was recalled
+// from, or false if there isn't one or the line has been edited since.
+func (b *Buffer) FromHistory() (int, bool) {
+	return b.recalledFrom, b.recalled
 }
 
 func (b *Buffer) String() string {
@@ -344,29 +755,41 @@ func (b *Buffer) StringN(n int) string {
 }
 
 func (b *Buffer) StringNM(n, m int) string {
-	var s string
 	if m == 0 {
 		m = b.Size()
 	}
+
+	var sb strings.Builder
 	for cnt := n; cnt < m; cnt++ {
-		c, _ := b.Buf.Get(cnt)
-		s += string(c.(rune))
+		sb.WriteRune(b.runeAt(cnt))
 	}
-	return s
+	return sb.String()
 }
 
 func cursorLeftN(n int) string {
+	if n <= 0 {
+		return ""
+	}
 	return fmt.Sprintf(CursorLeftN, n)
 }
 
 func cursorRightN(n int) string {
+	if n <= 0 {
+		return ""
+	}
 	return fmt.Sprintf(CursorRightN, n)
 }
 
 func cursorUpN(n int) string {
+	if n <= 0 {
+		return ""
+	}
 	return fmt.Sprintf(CursorUpN, n)
 }
 
 func cursorDownN(n int) string {
+	if n <= 0 {
+		return ""
+	}
 	return fmt.Sprintf(CursorDownN, n)
 }
@@ -0,0 +1,475 @@
+package readline
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRedraw(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> ", AltPrompt: "... "})
+	b.out = &out
+
+	for _, r := range "hello" {
+		b.Add(r)
+	}
+	b.MoveLeft()
+	b.MoveLeft()
+
+	// after being suspended the line is drawn again on a fresh row
+	out.Reset()
+	b.redraw()
+
+	want := CursorHide + CursorBOL + ">>> hello" + ClearToEOL + cursorLeftN(2) + CursorShow
+	if out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+
+	if b.Pos != 3 {
+		t.Fatalf("expected cursor at 3, got %d", b.Pos)
+	}
+}
+
+func TestBufferLength(t *testing.T) {
+	testCases := map[string]struct {
+		text  string
+		size  int
+		bytes int
+	}{
+		"empty":     {"", 0, 0},
+		"ascii":     {"hello", 5, 5},
+		"multibyte": {"héllo 世界", 8, 13},
+		"emoji":     {"👋", 1, 4},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+			b.out = io.Discard
+			b.AddString(v.text)
+
+			if b.Size() != v.size {
+				t.Errorf("expected size %d, got %d", v.size, b.Size())
+			}
+
+			if b.ByteLen() != v.bytes || b.ByteLen() != len(b.String()) {
+				t.Errorf("expected %d bytes, got %d", v.bytes, b.ByteLen())
+			}
+		})
+	}
+}
+
+func TestClearToEOS(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> ", AltPrompt: "... "})
+	b.out = &out
+
+	b.AddString(strings.Repeat("a", b.LineWidth+10))
+	if bytes.Contains(out.Bytes(), []byte(ClearToEOS)) {
+		t.Fatalf("didn't expect the screen to be cleared while the line grows")
+	}
+
+	// shrinking back onto one row has to clear the row below
+	out.Reset()
+	for cnt := 0; cnt < 20; cnt++ {
+		b.Remove()
+	}
+	if !bytes.Contains(out.Bytes(), []byte(ClearToEOS)) {
+		t.Fatalf("expected %q when the line shrinks, got %q", ClearToEOS, out.String())
+	}
+
+	// as does getting rid of the completion menu
+	b.showMenu([]Completion{{Text: "one"}, {Text: "two"}})
+	out.Reset()
+	b.dismissMenu()
+	if !bytes.HasSuffix(out.Bytes(), []byte(ClearToEOS)) {
+		t.Fatalf("expected %q when the menu is dismissed, got %q", ClearToEOS, out.String())
+	}
+}
+
+func TestReplaceMultiline(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> ", AltPrompt: "... "})
+	b.out = &out
+
+	// the prompt's already been printed
+	b.Replace([]rune("one line\ntwo"))
+	if expect := "one line" + ClearToEOL + "\r\n... two"; !strings.Contains(out.String(), expect) {
+		t.Fatalf("expected %q, got %q", expect, out.String())
+	}
+	if b.row != 1 || b.col != 3 || b.rows != 1 {
+		t.Fatalf("expected the cursor after two on row 1, got row %d col %d of %d", b.row, b.col, b.rows)
+	}
+
+	// going back to one line clears the second row
+	out.Reset()
+	b.Replace([]rune("x"))
+	if expect := cursorUpN(1) + CursorBOL + cursorRightN(4) + "x" + ClearToEOS; !strings.HasPrefix(out.String(), expect) {
+		t.Fatalf("expected %q, got %q", expect, out.String())
+	}
+	if b.row != 0 || b.rows != 0 {
+		t.Fatalf("expected one row, got row %d of %d", b.row, b.rows)
+	}
+}
+
+func TestHorizontalScroll(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.out = &out
+	b.LineWidth = 10
+	b.HorizontalScroll = true
+
+	check := func(text string, cursor int) {
+		t.Helper()
+		gotText, gotCursor := b.window()
+		if gotText != text || gotCursor != cursor {
+			t.Fatalf("expected %q with the cursor at %d, got %q at %d", text, cursor, gotText, gotCursor)
+		}
+
+		if !strings.HasSuffix(out.String(), CursorBOL+">>> "+text+ClearToEOL+CursorBOL+cursorRightN(4+cursor)) {
+			t.Fatalf("expected %q to be drawn, got %q", text, out.String())
+		}
+	}
+
+	b.AddString("abcdefghijklmnop")
+	check("<jklmnop", 8)
+
+	b.MoveToStart()
+	check("abcdefghi>", 0)
+
+	for cnt := 0; cnt < 10; cnt++ {
+		b.MoveRight()
+	}
+	check("<defghijk>", 8)
+
+	// once it fits again it's drawn as usual
+	b.MoveToEnd()
+	b.DeleteBefore()
+	b.AddString("short")
+	if b.scrolled {
+		t.Fatal("expected a short line not to be scrolled")
+	}
+}
+
+func TestHorizontalScrollFits(t *testing.T) {
+	var wrapped, scrolled bytes.Buffer
+	for _, out := range []*bytes.Buffer{&wrapped, &scrolled} {
+		b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+		b.out = out
+		b.LineWidth = 10
+		b.HorizontalScroll = out == &scrolled
+
+		b.AddString("short")
+		b.MoveLeft()
+		b.Remove()
+	}
+
+	if wrapped.String() != scrolled.String() {
+		t.Fatalf("expected %q, got %q", wrapped.String(), scrolled.String())
+	}
+}
+
+func TestIncrementalDraw(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.out = &out
+	b.LineWidth = 76
+
+	b.AddString("hello world")
+
+	// typing at the end only draws what's typed
+	out.Reset()
+	b.Add('!')
+	if out.String() != "!" {
+		t.Fatalf("expected %q, got %q", "!", out.String())
+	}
+
+	// typing in the middle draws the rest of the line
+	for cnt := 0; cnt < 7; cnt++ {
+		b.MoveLeft()
+	}
+	out.Reset()
+	b.Add(',')
+	if want := CursorHide + ", world!" + cursorLeftN(7) + CursorShow; out.String() != want {
+		t.Fatalf("expected %q, got %q", want, out.String())
+	}
+
+	out.Reset()
+	b.redraw()
+	full := out.Len()
+
+	b.MoveToEnd()
+	out.Reset()
+	b.Add('x')
+	if out.Len()*10 > full {
+		t.Fatalf("expected far fewer than %d bytes, got %d: %q", full, out.Len(), out.String())
+	}
+
+	// only the end of a recalled line that differs is drawn
+	b.Replace([]rune("hello world"))
+	out.Reset()
+	b.Replace([]rune("hello there"))
+	if strings.Contains(out.String(), "hello") || !strings.Contains(out.String(), "there") {
+		t.Fatalf("expected only the changed part to be drawn, got %q", out.String())
+	}
+
+	// but all of it when the prompt changes
+	b.Prompt.UseAlt = true
+	b.Prompt.AltPrompt = "... "
+	out.Reset()
+	b.Replace([]rune("hello there"))
+	if !strings.Contains(out.String(), "... hello there") {
+		t.Fatalf("expected the line to be drawn after the new prompt, got %q", out.String())
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	benchmarkDraw(b, func(buf *Buffer) {
+		buf.Add('x')
+	})
+}
+
+func BenchmarkInsertMiddle(b *testing.B) {
+	benchmarkDraw(b, func(buf *Buffer) {
+		buf.Pos = buf.Size() / 2
+		buf.Add('x')
+	})
+}
+
+func BenchmarkReplace(b *testing.B) {
+	benchmarkDraw(b, func(buf *Buffer) {
+		line := []rune(buf.String())
+		if line[len(line)-1] == 'x' {
+			line[len(line)-1] = 'y'
+		} else {
+			line[len(line)-1] = 'x'
+		}
+		buf.Replace(line)
+	})
+}
+
+// benchmarkDraw runs edit on a line of 60 runes, reporting how many bytes
+// each edit writes to the terminal.
+func benchmarkDraw(b *testing.B, edit func(*Buffer)) {
+	var out countWriter
+	buf, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	buf.out = &out
+	buf.LineWidth = 76
+
+	var written int
+	b.ResetTimer()
+	for cnt := 0; cnt < b.N; cnt++ {
+		if cnt%20 == 0 {
+			b.StopTimer()
+			buf.Replace([]rune(strings.Repeat("abc ", 15)))
+			b.StartTimer()
+		}
+
+		out = 0
+		edit(buf)
+		written += int(out)
+	}
+	b.ReportMetric(float64(written)/float64(b.N), "bytes/op")
+}
+
+type countWriter int
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w += countWriter(len(p))
+	return len(p), nil
+}
+
+// largeBuffer returns a line of 100KB with the cursor in the middle.
+func largeBuffer() *Buffer {
+	buf, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	buf.out = io.Discard
+	buf.LineWidth = 76
+	buf.AddString(strings.Repeat("abcd ", 20000))
+	buf.Pos = buf.Size() / 2
+	return buf
+}
+
+func BenchmarkLargeAddString(b *testing.B) {
+	buf := largeBuffer()
+	text := strings.Repeat("x", 1000)
+
+	b.ResetTimer()
+	for cnt := 0; cnt < b.N; cnt++ {
+		buf.AddString(text)
+		b.StopTimer()
+		buf.Pos -= 1000
+		buf.remove(buf.Pos, buf.Pos+1000)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkLargeAdd(b *testing.B) {
+	buf := largeBuffer()
+
+	b.ResetTimer()
+	for cnt := 0; cnt < b.N; cnt++ {
+		buf.Add('x')
+		buf.Remove()
+	}
+}
+
+func BenchmarkLargeDeleteBefore(b *testing.B) {
+	buf := largeBuffer()
+	line := []rune(buf.String())
+
+	b.ResetTimer()
+	for cnt := 0; cnt < b.N; cnt++ {
+		buf.DeleteBefore()
+		b.StopTimer()
+		buf.Replace(line)
+		buf.Pos = buf.Size() / 2
+		b.StartTimer()
+	}
+}
+
+func BenchmarkLargeString(b *testing.B) {
+	buf := largeBuffer()
+
+	b.ResetTimer()
+	for cnt := 0; cnt < b.N; cnt++ {
+		_ = buf.String()
+	}
+}
+
+func TestClear(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> ", AltPrompt: "... "})
+	b.out = &out
+
+	b.AddString("one\ntwo")
+	b.MoveLeft()
+	b.setSuggestion("more")
+	b.Clear()
+
+	if !b.IsEmpty() || b.String() != "" {
+		t.Fatalf("expected an empty line, got %q", b.String())
+	}
+	if b.Pos != 0 || b.row != 0 || b.rows != 0 {
+		t.Fatalf("expected the cursor at the start, got %d on row %d of %d", b.Pos, b.row, b.rows)
+	}
+	if b.suggestion != "" {
+		t.Fatalf("expected no suggestion, got %q", b.suggestion)
+	}
+
+	// what's typed next starts a new line as usual
+	b.Add('x')
+	if b.String() != "x" || b.Pos != 1 {
+		t.Fatalf("expected %q with the cursor after it, got %q at %d", "x", b.String(), b.Pos)
+	}
+}
+
+func TestGraphemeClusters(t *testing.T) {
+	type testCase struct {
+		text string
+		cols int
+	}
+
+	testCases := map[string]*testCase{
+		"flag":         {text: "🇯🇵", cols: 2},
+		"family":       {text: "👨‍👩‍👧", cols: 2},
+		"skin tone":    {text: "👍🏽", cols: 2},
+		"combining":    {text: "é", cols: 1},
+		"double width": {text: "漢", cols: 2},
+	}
+
+	for name, tc := range testCases {
+		var out bytes.Buffer
+		b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+		b.out = &out
+
+		b.AddString("a" + tc.text)
+		if b.col != 1+tc.cols {
+			t.Fatalf("%s: expected the cursor at column %d, got %d", name, 1+tc.cols, b.col)
+		}
+
+		b.MoveLeft()
+		if b.Pos != 1 || b.col != 1 {
+			t.Fatalf("%s: expected the cursor before it, got %d at column %d", name, b.Pos, b.col)
+		}
+
+		b.MoveRight()
+		if b.Pos != b.Size() || b.col != 1+tc.cols {
+			t.Fatalf("%s: expected the cursor after it, got %d at column %d", name, b.Pos, b.col)
+		}
+
+		b.Remove()
+		if b.String() != "a" || b.Pos != 1 || b.col != 1 {
+			t.Fatalf("%s: expected all of it removed, got %q with the cursor at %d column %d", name, b.String(), b.Pos, b.col)
+		}
+
+		b.AddString(tc.text + "b")
+		b.MoveToStart()
+		b.MoveRight()
+		b.Delete()
+		if b.String() != "ab" {
+			t.Fatalf("%s: expected all of it deleted, got %q", name, b.String())
+		}
+	}
+}
+
+func TestGraphemeWrap(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.out = &out
+	b.LineWidth = 4
+
+	// the family fills the row, and the rest of it is drawn with it before
+	// moving on to the next
+	b.AddString("ab👨‍👩‍👧c")
+	if expect := "ab👨‍👩‍👧\r\nc"; !strings.Contains(out.String(), expect) {
+		t.Fatalf("expected %q, got %q", expect, out.String())
+	}
+	if b.row != 1 || b.col != 1 {
+		t.Fatalf("expected the cursor on row 1 column 1, got row %d column %d", b.row, b.col)
+	}
+}
+
+func TestGraphemeTyped(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.out = &out
+
+	// each rune that joins the cluster draws it again from its start
+	for _, r := range "a👨‍👩‍👧" {
+		b.Add(r)
+	}
+	if b.col != 3 {
+		t.Fatalf("expected the cursor at column 3, got %d", b.col)
+	}
+	if expect := cursorLeftN(2) + "👨‍👩‍👧"; !strings.HasSuffix(out.String(), expect) {
+		t.Fatalf("expected %q at the end, got %q", expect, out.String())
+	}
+}
+
+func TestRenderedRows(t *testing.T) {
+	testCases := map[string]int{
+		"":                       1,
+		"short":                  1,
+		"ten chars!":             2,
+		"wraps onto two":         2,
+		"wraps onto a third row": 3,
+		"one\ntwo":               2,
+		"one\ntwo\nthree":        3,
+		"one\nwraps twice..":     3,
+		"漢字漢字漢":                  2,
+	}
+
+	for text, rows := range testCases {
+		var out bytes.Buffer
+		b, _ := NewBuffer(&Prompt{Prompt: ">>> ", AltPrompt: "... "})
+		b.out = &out
+		b.Width, b.LineWidth = 14, 10
+
+		b.AddString(text)
+		if got := b.RenderedRows(); got != rows {
+			t.Fatalf("%q: expected %d rows, got %d", text, rows, got)
+		}
+	}
+}
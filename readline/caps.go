@@ -0,0 +1,81 @@
+package readline
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// TermCapabilities describes what the terminal is likely to support. It's
+// guessed from the environment so it errs on the side of caution.
+type TermCapabilities struct {
+	Color          bool // any colour at all, off when the output isn't a terminal
+	Color256       bool // the 256 colour palette, which TrueColor implies
+	TrueColor      bool
+	BracketedPaste bool
+	Clipboard      bool // setting the clipboard with OSC 52
+}
+
+// terminals which are known to understand bracketed paste
+var pasteTerms = []string{"xterm", "screen", "tmux", "rxvt", "alacritty", "foot", "wezterm", "konsole", "gnome", "vte", "st-"}
+
+// terminals which are known to allow OSC 52 by default
+var clipboardTerms = []string{"xterm-kitty", "alacritty", "foot", "wezterm", "tmux"}
+
+func detectCapabilities() TermCapabilities {
+	var caps TermCapabilities
+
+	termType := os.Getenv("TERM")
+	if termType == "dumb" {
+		return caps
+	}
+
+	// Windows Terminal doesn't set TERM
+	if os.Getenv("WT_SESSION") != "" {
+		caps.TrueColor = true
+		caps.BracketedPaste = true
+	}
+
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		caps.TrueColor = true
+	}
+
+	if strings.HasSuffix(termType, "-direct") || strings.Contains(termType, "truecolor") {
+		caps.TrueColor = true
+	}
+
+	if caps.TrueColor || strings.Contains(termType, "256color") {
+		caps.Color256 = true
+	}
+
+	for _, p := range pasteTerms {
+		if strings.HasPrefix(termType, p) {
+			caps.BracketedPaste = true
+		}
+	}
+
+	for _, p := range clipboardTerms {
+		if strings.HasPrefix(termType, p) {
+			caps.Clipboard = true
+		}
+	}
+
+	return caps
+}
+
+// colorEnabled reports whether colours should be written to w. They're left
+// out when w isn't a terminal, for TERM=dumb, and when NO_COLOR is set, so
+// that redirected output stays clean.
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,37 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	type testCase struct {
+		term      string
+		colorterm string
+		expect    TermCapabilities
+	}
+
+	testCases := map[string]*testCase{
+		"dumb":            {term: "dumb", colorterm: "truecolor", expect: TermCapabilities{}},
+		"unset":           {term: "", expect: TermCapabilities{}},
+		"vt100":           {term: "vt100", expect: TermCapabilities{}},
+		"xterm":           {term: "xterm", expect: TermCapabilities{BracketedPaste: true}},
+		"xterm 256":       {term: "xterm-256color", expect: TermCapabilities{Color256: true, BracketedPaste: true}},
+		"xterm truecolor": {term: "xterm-256color", colorterm: "truecolor", expect: TermCapabilities{Color256: true, TrueColor: true, BracketedPaste: true}},
+		"xterm direct":    {term: "xterm-direct", expect: TermCapabilities{Color256: true, TrueColor: true, BracketedPaste: true}},
+		"kitty":           {term: "xterm-kitty", colorterm: "truecolor", expect: TermCapabilities{Color256: true, TrueColor: true, BracketedPaste: true, Clipboard: true}},
+		"tmux":            {term: "tmux-256color", expect: TermCapabilities{Color256: true, BracketedPaste: true, Clipboard: true}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv("TERM", v.term)
+			t.Setenv("COLORTERM", v.colorterm)
+			t.Setenv("WT_SESSION", "")
+
+			if caps := detectCapabilities(); caps != v.expect {
+				t.Fatalf("expected %+v, got %+v", v.expect, caps)
+			}
+		})
+	}
+}
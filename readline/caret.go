@@ -0,0 +1,33 @@
+package readline
+
+import "github.com/mattn/go-runewidth"
+
+// isControl reports whether r is a control character that has a caret
+// notation, other than newline which starts a new row.
+func isControl(r rune) bool {
+	return (r < CharSpace && r != '\n') || r == CharBackspace
+}
+
+// caret returns r in caret notation, such as ^A for Ctrl+A and ^? for DEL.
+func caret(r rune) string {
+	if r == CharBackspace {
+		return "^?"
+	}
+	return "^" + string(r+'@')
+}
+
+// glyph returns what's drawn for r.
+func (b *Buffer) glyph(r rune) string {
+	if b.CaretNotation && isControl(r) {
+		return caret(r)
+	}
+	return string(r)
+}
+
+// runeWidth returns how many columns r takes up when it's drawn.
+func (b *Buffer) runeWidth(r rune) int {
+	if b.CaretNotation && isControl(r) {
+		return 2
+	}
+	return runewidth.RuneWidth(r)
+}
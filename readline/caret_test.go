@@ -0,0 +1,113 @@
+package readline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCaretNotation(t *testing.T) {
+	type testCase struct {
+		input  string
+		caret  bool
+		expect string
+		shown  string
+	}
+
+	testCases := map[string]*testCase{
+		"ctrl a":      {"a\x16\x01b\r", true, "a\x01b", ">>> a^Ab"},
+		"escape":      {"\x16\x1b[A\r", true, "\x1b[A", ">>> ^[[A"},
+		"delete":      {"x\x16\x7f\r", true, "x\x7f", ">>> x^?"},
+		"removed":     {"a\x16\x01\x7fb\r", true, "ab", ">>> a"},
+		"quoted ctrl": {"\x16\x03\x16\x04\r", true, "\x03\x04", ">>> ^C^D"},
+		"raw":         {"a\x16\x01b\r", false, "a\x01b", ">>> a\x01b"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(v.input)
+			i.CaretNotation = v.caret
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			if !strings.Contains(out.String(), v.shown) {
+				t.Fatalf("expected %q to be shown, got %q", v.shown, out.String())
+			}
+		})
+	}
+}
+
+func TestAllowControlChars(t *testing.T) {
+	type testCase struct {
+		input  string
+		allow  bool
+		expect string
+		shown  string
+	}
+
+	testCases := map[string]*testCase{
+		"nul dropped":      {"a\x00b\r", false, "ab", ">>> ab"},
+		"control dropped":  {"a\x1cb\r", false, "ab", ">>> ab"},
+		"nul allowed":      {"a\x00b\r", true, "a\x00b", ">>> a^@b"},
+		"control allowed":  {"a\x1cb\r", true, "a\x1cb", ">>> a^\\b"},
+		"repeated":         {"\x1b3\x11\r", true, "\x11\x11\x11", ">>> ^Q^Q^Q"},
+		"bound keys work":  {"ab\x01\x00\r", true, "\x00ab", "^@ab"},
+		"enter still ends": {"a\x00\rb\r", true, "a\x00", ">>> a^@"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(v.input)
+			i.AllowControlChars = v.allow
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			if !strings.Contains(out.String(), v.shown) {
+				t.Fatalf("expected %q to be shown, got %q", v.shown, out.String())
+			}
+		})
+	}
+}
+
+func TestCaretWidth(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.out = &out
+	b.LineWidth = 10
+	b.CaretNotation = true
+
+	b.AddString("abc\x01def")
+	if pos := b.positions(); pos[4] != (position{0, 5}) {
+		t.Fatalf("expected the rune after ^A at column 5, got %v", pos[4])
+	}
+
+	// moving back over it moves two columns
+	b.MoveLeft()
+	b.MoveLeft()
+	b.MoveLeft()
+	out.Reset()
+	b.MoveLeft()
+	if out.String() != cursorLeftN(2) {
+		t.Fatalf("expected %q, got %q", cursorLeftN(2), out.String())
+	}
+
+	// ^A isn't split across rows
+	b.Replace([]rune("abcdefghi\x01"))
+	if pos := b.positions(); pos[9] != (position{1, 0}) || pos[10] != (position{1, 2}) {
+		t.Fatalf("expected ^A to wrap onto the next row, got %v", pos[9:])
+	}
+}
@@ -0,0 +1,122 @@
+package readline
+
+import "fmt"
+
+// Colors are what the text Readline draws in place of input is shown in.
+// The zero value draws all of it in grey.
+type Colors struct {
+	Placeholder Color
+	Suggestion  Color
+	Hint        Color // for what SetStatus shows under the line
+}
+
+// Color is a foreground colour. The zero Color is ColorGrey.
+type Color struct {
+	rgb     bool
+	r, g, b uint8
+}
+
+// RGB returns a 24-bit colour. Terminals which don't support it, going by
+// TermCapabilities, are sent the closest of their 256 colours, or of the 16
+// basic ones.
+func RGB(r, g, b uint8) Color {
+	return Color{rgb: true, r: r, g: g, b: b}
+}
+
+// colorDepth is how many colours a terminal can show.
+type colorDepth int
+
+const (
+	colorBasic colorDepth = iota // the 8 colours and their bright versions
+	color256
+	colorTrue
+)
+
+// depth returns how many colours the terminal with caps can show.
+func (caps TermCapabilities) depth() colorDepth {
+	switch {
+	case caps.TrueColor:
+		return colorTrue
+	case caps.Color256:
+		return color256
+	}
+	return colorBasic
+}
+
+// escape returns the escape sequence which switches to c.
+func (c Color) escape(depth colorDepth) string {
+	switch {
+	case !c.rgb && depth == colorBasic:
+		return ColorBrightBlack
+	case !c.rgb:
+		return ColorGrey
+	case depth == colorTrue:
+		return fmt.Sprintf("\033[38;2;%d;%d;%dm", c.r, c.g, c.b)
+	case depth == color256:
+		return fmt.Sprintf("\033[38;5;%dm", c.xterm256())
+	}
+
+	n := c.basic()
+	if n >= 8 {
+		return fmt.Sprintf("\033[%dm", 90+n-8)
+	}
+	return fmt.Sprintf("\033[%dm", 30+n)
+}
+
+// paint returns s in the colour c, or s alone when the terminal doesn't
+// get colours.
+func (b *Buffer) paint(c Color, s string) string {
+	if !b.color {
+		return s
+	}
+	return c.escape(b.colorDepth) + s + ColorDefault
+}
+
+// basicColors are the 16 basic colours as xterm shows them by default
+var basicColors = [16][3]int{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// basic returns the closest of the 16 basic colours, with 8 and above being
+// the bright versions.
+func (c Color) basic() int {
+	closest, best := 0, -1
+	for n, v := range basicColors {
+		dr, dg, db := int(c.r)-v[0], int(c.g)-v[1], int(c.b)-v[2]
+		if d := dr*dr + dg*dg + db*db; best < 0 || d < best {
+			closest, best = n, d
+		}
+	}
+	return closest
+}
+
+// xterm256 returns the closest colour from the 6x6x6 cube of the 256 colour
+// palette, or from its grey ramp for greys.
+func (c Color) xterm256() int {
+	if c.r == c.g && c.g == c.b {
+		switch v := int(c.r); {
+		case v < 4:
+			return 16
+		case v > 246:
+			return 231
+		default:
+			// the ramp goes from 8 to 238 in steps of 10
+			return 232 + min((v-3)/10, 23)
+		}
+	}
+
+	// the cube's levels are 0, 95, 135, 175, 215 and 255
+	level := func(v uint8) int {
+		if v < 48 {
+			return 0
+		}
+		if v < 115 {
+			return 1
+		}
+		return (int(v) - 35) / 40
+	}
+	return 16 + 36*level(c.r) + 6*level(c.g) + level(c.b)
+}
@@ -0,0 +1,113 @@
+package readline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColorEscape(t *testing.T) {
+	type testCase struct {
+		color     Color
+		trueColor string
+		palette   string
+		basic     string
+	}
+
+	testCases := map[string]*testCase{
+		"default":  {Color{}, ColorGrey, ColorGrey, ColorBrightBlack},
+		"red":      {RGB(255, 0, 0), "\x1b[38;2;255;0;0m", "\x1b[38;5;196m", "\x1b[91m"},
+		"dark red": {RGB(180, 20, 10), "\x1b[38;2;180;20;10m", "\x1b[38;5;124m", "\x1b[31m"},
+		"teal":     {RGB(0, 128, 128), "\x1b[38;2;0;128;128m", "\x1b[38;5;30m", "\x1b[36m"},
+		"grey":     {RGB(128, 128, 128), "\x1b[38;2;128;128;128m", "\x1b[38;5;244m", "\x1b[90m"},
+		"black":    {RGB(0, 0, 0), "\x1b[38;2;0;0;0m", "\x1b[38;5;16m", "\x1b[30m"},
+		"white":    {RGB(255, 255, 255), "\x1b[38;2;255;255;255m", "\x1b[38;5;231m", "\x1b[97m"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			if got := v.color.escape(colorTrue); got != v.trueColor {
+				t.Fatalf("expected %q, got %q", v.trueColor, got)
+			}
+
+			if got := v.color.escape(color256); got != v.palette {
+				t.Fatalf("expected %q, got %q", v.palette, got)
+			}
+
+			if got := v.color.escape(colorBasic); got != v.basic {
+				t.Fatalf("expected %q, got %q", v.basic, got)
+			}
+		})
+	}
+}
+
+func TestColors(t *testing.T) {
+	type testCase struct {
+		caps        TermCapabilities
+		placeholder string
+		suggestion  string
+	}
+
+	testCases := map[string]*testCase{
+		"basic":      {TermCapabilities{Color: true}, "\x1b[34m", "\x1b[91m"},
+		"256 colour": {TermCapabilities{Color: true, Color256: true}, "\x1b[38;5;21m", "\x1b[38;5;196m"},
+		"truecolor":  {TermCapabilities{Color: true, Color256: true, TrueColor: true}, "\x1b[38;2;0;0;255m", "\x1b[38;2;255;0;0m"},
+	}
+
+	for k, v := range testCases {
+		i, out := newTestInstance("he\r")
+		i.Terminal.caps = v.caps
+		i.Colors = Colors{Placeholder: RGB(0, 0, 255), Suggestion: RGB(255, 0, 0)}
+		i.Prompt.Placeholder = "type here"
+		i.SuggestFunc = func(line string) string {
+			return "llo"
+		}
+
+		if _, err := i.Readline(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(out.String(), v.placeholder+"type here") {
+			t.Fatalf("%s: expected the placeholder in %q, got %q", k, v.placeholder, out.String())
+		}
+
+		if !strings.Contains(out.String(), v.suggestion+"llo") {
+			t.Fatalf("%s: expected the suggestion in %q, got %q", k, v.suggestion, out.String())
+		}
+
+		if strings.Contains(out.String(), ColorGrey) || strings.Contains(out.String(), ColorBrightBlack) {
+			t.Fatalf("%s: didn't expect grey, got %q", k, out.String())
+		}
+	}
+}
+
+func TestHintColor(t *testing.T) {
+	type testCase struct {
+		caps   TermCapabilities
+		hint   Color
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"default":    {TermCapabilities{Color: true, Color256: true}, Color{}, ColorGrey},
+		"basic":      {TermCapabilities{Color: true}, Color{}, ColorBrightBlack},
+		"256 colour": {TermCapabilities{Color: true, Color256: true}, RGB(0, 255, 0), "\x1b[38;5;46m"},
+		"no colour":  {TermCapabilities{}, RGB(0, 255, 0), ""},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance("\r")
+			i.Terminal.caps = v.caps
+			i.Colors.Hint = v.hint
+			i.SetStatus("tab to complete")
+
+			if _, err := i.Readline(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(out.String(), "\r\n"+v.expect+"tab to complete") {
+				t.Fatalf("expected the hint in %q, got %q", v.expect, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package readline
+
+import (
+	"unicode"
+)
+
+// Completion is a candidate for completing the word before the cursor.
+type Completion struct {
+	Text string
+
+	// Suffix is added after Text when it's the only candidate, such as a
+	// space after a finished command or a slash after a directory
+	Suffix string
+}
+
+// completions calls CompletionFunc, or Completer if it isn't set.
+func (i *Instance) completions(line string, pos int) []Completion {
+	if i.CompletionFunc != nil {
+		return i.CompletionFunc(line, pos)
+	}
+
+	var candidates []Completion
+	for _, c := range i.Completer(line, pos) {
+		candidates = append(candidates, Completion{Text: c})
+	}
+	return candidates
+}
+
+// autoComplete shows the menu of candidates when r is one of
+// AutoCompleteTriggers. It waits until r is the last key that's arrived so
+// the menu isn't brought up over and over while typing quickly.
+func (i *Instance) autoComplete(buf *Buffer, r rune) {
+	if i.Completer == nil && i.CompletionFunc == nil || len(i.Terminal.peek(1)) > 0 {
+		return
+	}
+
+	for _, trigger := range i.AutoCompleteTriggers {
+		if r == trigger {
+			if candidates := i.completions(buf.String(), buf.Pos); len(candidates) > 0 {
+				buf.showMenu(candidates)
+			}
+			return
+		}
+	}
+}
+
+// wordStart returns the index of the start of the word before the cursor.
+func (b *Buffer) wordStart() int {
+	pos := b.Pos
+	for pos > 0 && !unicode.IsSpace(b.runeAt(pos-1)) {
+		pos -= 1
+	}
+	return pos
+}
+
+// complete replaces the word before the cursor with the only candidate, or
+// extends it with whatever all of the candidates have in common. It returns
+// false if there was nothing to add.
+func (b *Buffer) complete(candidates []Completion) bool {
+	if len(candidates) == 0 {
+		return false
+	}
+
+	prefix := []rune(candidates[0].Text)
+	for _, c := range candidates[1:] {
+		prefix = commonPrefix(prefix, []rune(c.Text))
+	}
+	if len(candidates) == 1 {
+		prefix = append(prefix, []rune(candidates[0].Suffix)...)
+	}
+
+	start := b.wordStart()
+	if len(prefix) <= b.Pos-start && len(candidates) > 1 {
+		return false
+	}
+
+	b.remove(start, b.Pos)
+	b.Pos = start
+	if len(prefix) == 0 {
+		b.draw()
+	} else {
+		b.AddString(string(prefix))
+	}
+	return true
+}
+
+func commonPrefix(a, b []rune) []rune {
+	n := min(len(a), len(b))
+	for cnt := 0; cnt < n; cnt++ {
+		if a[cnt] != b[cnt] {
+			return a[:cnt]
+		}
+	}
+	return a[:n]
+}
@@ -0,0 +1,60 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestCompletionSuffix(t *testing.T) {
+	type testCase struct {
+		candidates []Completion
+		input      string
+		expect     string
+	}
+
+	testCases := map[string]*testCase{
+		"space":      {[]Completion{{Text: "/help", Suffix: " "}}, "/he\tme\r", "/help me"},
+		"no space":   {[]Completion{{Text: "models/"}}, "mo\tx\r", "models/x"},
+		"slash":      {[]Completion{{Text: "models", Suffix: "/"}}, "mo\tx\r", "models/x"},
+		"ambiguous":  {[]Completion{{Text: "show", Suffix: " "}, {Text: "shell", Suffix: " "}}, "s\tx\r", "shx"},
+		"whole word": {[]Completion{{Text: "help", Suffix: " "}}, "help\t\r", "help "},
+		"mid line":   {[]Completion{{Text: "run", Suffix: " "}}, "r model\x01\x06\t\r", "run  model"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.CompletionFunc = func(line string, pos int) []Completion {
+				return v.candidates
+			}
+			i.Completer = func(line string, pos int) []string {
+				t.Fatal("expected CompletionFunc to be used")
+				return nil
+			}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
+
+func TestCompleterStrings(t *testing.T) {
+	i, _ := newTestInstance("he\tx\r")
+	i.Completer = func(line string, pos int) []string {
+		return []string{"help"}
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "helpx" {
+		t.Fatalf("expected %q, got %q", "helpx", line)
+	}
+}
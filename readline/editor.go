@@ -0,0 +1,72 @@
+package readline
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editor returns the command for editing a line, from $VISUAL or $EDITOR, or
+// a default if neither is set.
+func editor() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if cmd := strings.Fields(os.Getenv(env)); len(cmd) > 0 {
+			return cmd
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editLine opens line in an editor, with the terminal out of raw mode if
+// cooked is set, and returns what the file holds once the editor exits
+// successfully. A newline at the end, which most editors add, is dropped.
+func (i *Instance) editLine(line string, cooked func(func() error) error) (string, error) {
+	f, err := os.CreateTemp("", "ollama-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	args := editor()
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(path, append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// the editor reads the terminal itself
+	i.Terminal.pause()
+	defer i.Terminal.resume()
+
+	if cooked != nil {
+		err = cooked(cmd.Run)
+	} else {
+		err = cmd.Run()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+
+	s := strings.TrimSuffix(string(edited), "\n")
+	return strings.TrimSuffix(s, "\r"), nil
+}
@@ -0,0 +1,70 @@
+package readline
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEditLine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the editors are shell scripts")
+	}
+
+	type testCase struct {
+		script string
+		input  string
+		expect string
+		bell   bool
+	}
+
+	testCases := map[string]*testCase{
+		"rewritten":  {script: `tr a-z A-Z < "$1" > "$1.new" && mv "$1.new" "$1"`, input: "hello\x18\x05!\r", expect: "HELLO!"},
+		"lines":      {script: `printf 'one\ntwo\n' > "$1"`, input: "hello\x18\x05\r", expect: "one\ntwo"},
+		"failed":     {script: `echo changed > "$1"; exit 1`, input: "hello\x18\x05!\r", expect: "hello!", bell: true},
+		"not found":  {input: "hello\x18\x05!\r", expect: "hello!", bell: true},
+		"not prefix": {script: `echo changed > "$1"`, input: "hello\x18x\x05!\r", expect: "hellox!"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			editor := filepath.Join(t.TempDir(), "editor")
+			if v.script != "" {
+				if err := os.WriteFile(editor, []byte("#!/bin/sh\n"+v.script+"\n"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", editor)
+
+			i, out := newTestInstance(v.input)
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			if bell := bytes.ContainsRune(out.Bytes(), CharBell); bell != v.bell {
+				t.Fatalf("expected bell %v, got %q", v.bell, out.String())
+			}
+		})
+	}
+}
+
+func TestEditor(t *testing.T) {
+	t.Setenv("VISUAL", "code --wait")
+	t.Setenv("EDITOR", "nano")
+	if got := editor(); len(got) != 2 || got[0] != "code" || got[1] != "--wait" {
+		t.Fatalf("expected VISUAL to be used, got %q", got)
+	}
+
+	t.Setenv("VISUAL", "")
+	if got := editor(); len(got) != 1 || got[0] != "nano" {
+		t.Fatalf("expected EDITOR to be used, got %q", got)
+	}
+}
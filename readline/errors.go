@@ -2,10 +2,18 @@ package readline
 
 import (
 	"errors"
+	"io"
 )
 
 var (
 	ErrInterrupt = errors.New("Interrupt")
+
+	// ErrTimeout is returned when nothing's typed for AutoSubmitAfter, or
+	// the line isn't submitted in time for ReadlineTimeout
+	ErrTimeout = errors.New("timed out waiting for input")
+
+	errSequenceTimeout = errors.New("the rest of the key sequence didn't arrive")
+	errCanceled        = errors.New("reading lines was canceled")
 )
 
 type InterruptError struct {
@@ -15,3 +23,22 @@ type InterruptError struct {
 func (*InterruptError) Error() string {
 	return "Interrupted"
 }
+
+// errWriter keeps the first error from writing to w and drops anything
+// written after it.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+	return n, err
+}
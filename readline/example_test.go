@@ -0,0 +1,42 @@
+package readline_test
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jmorganca/ollama/readline"
+)
+
+func ExampleNewBuffer() {
+	buf, err := readline.NewBuffer(&readline.Prompt{Prompt: ">>> "})
+	if err != nil {
+		panic(err)
+	}
+	buf.SetOutput(io.Discard)
+
+	buf.AddString("hello world")
+	buf.MoveLeftWord()
+	buf.DeleteRemaining()
+	buf.AddString("there")
+	buf.MoveToStart()
+	buf.Delete()
+	buf.Add('H')
+
+	fmt.Println(buf.String(), buf.Pos, buf.Size())
+	// Output: Hello there 1 11
+}
+
+func ExampleBuffer_Replace() {
+	buf, err := readline.NewBuffer(&readline.Prompt{Prompt: ">>> "})
+	if err != nil {
+		panic(err)
+	}
+	buf.SetOutput(io.Discard)
+
+	buf.AddString("draft")
+	buf.Replace([]rune("from history"))
+	buf.DeleteWord()
+
+	fmt.Printf("%q\n", buf.String())
+	// Output: "from "
+}
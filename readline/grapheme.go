@@ -0,0 +1,110 @@
+package readline
+
+import (
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+// boundary reports whether a grapheme cluster certainly ends between a and
+// b without segmenting the text, which is the case for most of it. Clusters
+// never go past a newline.
+func boundary(a, b rune) bool {
+	return a == '\n' || b == '\n' || a < 0x300 && b < 0x300
+}
+
+// clusterWidth returns how many columns a grapheme cluster of more than one
+// rune takes up. A flag is two regional indicators drawn as one wide glyph,
+// and anything else is as wide as its first rune that has a width.
+func clusterWidth(runes []rune) int {
+	if len(runes) == 2 && isRegional(runes[0]) && isRegional(runes[1]) {
+		return 2
+	}
+	for _, r := range runes {
+		if w := runewidth.RuneWidth(r); w > 0 {
+			return w
+		}
+	}
+	return 0
+}
+
+func isRegional(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// widths returns how many columns each rune takes up when the line is drawn,
+// and which runes join the grapheme cluster before them, such as the rest of
+// a flag or of emoji joined with ZWJ. The first rune of a cluster takes the
+// width of all of it and the rest take none. Masked runes are drawn one at
+// a time so they're never joined.
+func (b *Buffer) widths() ([]int, []bool) {
+	runes := make([]rune, b.Size())
+	for cnt := range runes {
+		runes[cnt] = b.runeAt(cnt)
+	}
+
+	widths := make([]int, len(runes))
+	joined := make([]bool, len(runes))
+	cluster := func(start, end int) {
+		if end == start+1 || b.isMasked(start) || b.isMasked(end-1) {
+			for cnt := start; cnt < end; cnt++ {
+				widths[cnt] = b.runeWidth(b.shown(cnt))
+			}
+			return
+		}
+
+		widths[start] = clusterWidth(runes[start:end])
+		for cnt := start + 1; cnt < end; cnt++ {
+			joined[cnt] = true
+		}
+	}
+
+	for start := 0; start < len(runes); {
+		end := start + 1
+		for end < len(runes) && !boundary(runes[end-1], runes[end]) {
+			end += 1
+		}
+
+		// only text that might have clusters in it is segmented
+		if end == start+1 {
+			cluster(start, end)
+		} else {
+			pos := start
+			g := uniseg.NewGraphemes(string(runes[start:end]))
+			for g.Next() {
+				size := len(g.Runes())
+				cluster(pos, pos+size)
+				pos += size
+			}
+		}
+		start = end
+	}
+	return widths, joined
+}
+
+// clusterStart returns where the grapheme cluster with the rune at pos in it
+// starts.
+func (b *Buffer) clusterStart(pos int) int {
+	if pos <= 0 || pos >= b.Size() || boundary(b.runeAt(pos-1), b.runeAt(pos)) {
+		return pos
+	}
+
+	_, joined := b.widths()
+	for pos > 0 && joined[pos] {
+		pos -= 1
+	}
+	return pos
+}
+
+// clusterEnd returns where the grapheme cluster starting at pos ends.
+func (b *Buffer) clusterEnd(pos int) int {
+	if pos+1 >= b.Size() || boundary(b.runeAt(pos), b.runeAt(pos+1)) {
+		return min(pos+1, b.Size())
+	}
+
+	_, joined := b.widths()
+	pos += 1
+	for pos < b.Size() && joined[pos] {
+		pos += 1
+	}
+	return pos
+}
@@ -6,26 +6,130 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/emirpasic/gods/lists/arraylist"
 )
 
+type SearchCase int
+
+const (
+	SearchCaseInsensitive SearchCase = iota
+	SearchCaseSensitive
+	// SearchCaseSmart is case-sensitive only if the query contains an
+	// uppercase letter
+	SearchCaseSmart
+)
+
 type History struct {
-	Buf      *arraylist.List
-	Autosave bool
-	Pos      int
-	Limit    int
-	Filename string
-	Enabled  bool
+	Buf        *arraylist.List
+	Autosave   bool
+	Pos        int
+	Limit      int
+	Filename   string
+	Enabled    bool
+	SearchCase SearchCase
+
+	// SearchWrap makes Ctrl+R and Ctrl+S go round to the other end of the
+	// history once there are no more matches, rather than failing
+	SearchWrap bool
+
+	// Filter can rewrite an entry before it's stored, or reject it by
+	// returning false. It's applied before the entry is saved.
+	Filter func(entry string) (store string, ok bool)
+
+	// CommentPrefix keeps lines starting with it out of the history, such as
+	// "#" for comments pasted from a script. Readline still returns them.
+	// Lines read from input that isn't a terminal, such as a piped script,
+	// never go into the history, so it isn't needed for those.
+	CommentPrefix string
+
+	// StorePastes adds lines submitted during a bracketed paste to the
+	// history, with all of the lines of one paste kept as a single entry
+	StorePastes bool
+
+	// Timestamps saves when each entry was added on a "#<unix time>" line
+	// before it, like bash does with HISTTIMEFORMAT
+	Timestamps bool
+
+	// PrefixSearch makes Up and Down only visit entries that start with
+	// what had been typed when Up was first pressed, like bash's
+	// history-search-backward. Case is ignored as SearchCase says.
+	// PrefixMatch replaces that match, such as to skip a leading "sudo ".
+	PrefixSearch bool
+	PrefixMatch  func(prefix, entry string) bool
+
+	// Shared lets several sessions save to the same history file at once.
+	// Saving locks the file and adds the entries added since the last save
+	// to what's in it, so entries from every session are kept in the order
+	// they were saved, rather than each session writing over the others.
+	// Entries other sessions save only show up once the file is loaded.
+	Shared bool
+
+	// Store keeps the entries in place of Buf if it's set, such as in a
+	// database. Pos, filtering and searching still work as they do for Buf,
+	// but Limit, Timestamps and the history file are left to the store. See
+	// NewStoreHistory.
+	Store HistoryStore
+
+	// when each entry in Buf was added, or zero if it isn't known
+	times []int64
+
+	// shown limits Prev and Next to the entries it returns true for
+	shown func(entry string) bool
+
+	// what PrefixSearch matches, from when the walk through the history
+	// started
+	prefix string
+
+	// for Shared, the entries added since the history was last saved, and
+	// the entries that were saved since but have been replaced
+	unsaved  []historyEntry
+	replaced [][]rune
+}
+
+// historyEntry is an entry as it's saved in the history file, with when it
+// was added, or zero if it isn't known.
+type historyEntry struct {
+	line []rune
+	ts   int64
+}
+
+// HistoryStore holds history entries, oldest first, somewhere other than in
+// memory.
+type HistoryStore interface {
+	// Add stores a new entry after the newest
+	Add(line []rune)
+	// ReplaceLast swaps the newest entry for line, which is how the lines of
+	// a paste are kept together
+	ReplaceLast(line []rune)
+	Size() int
+	Entry(n int) []rune
+}
+
+// HistorySearcher is a HistoryStore that can search its own entries, such as
+// with an index, rather than have Search and PrefixSearch read them one at a
+// time. Both methods return the index of the first entry that matches,
+// starting at start and moving towards older entries, or newer entries if
+// forward is set, and false if none do. fold says to ignore case.
+type HistorySearcher interface {
+	HistoryStore
+	// Search finds an entry containing query
+	Search(query string, start int, forward, fold bool) (int, bool)
+	// SearchPrefix finds an entry starting with prefix
+	SearchPrefix(prefix string, start int, forward, fold bool) (int, bool)
 }
 
 func NewHistory() (*History, error) {
 	h := &History{
-		Buf:      arraylist.New(),
-		Limit:    100, //resizeme
-		Autosave: true,
-		Enabled:  true,
+		Buf:         arraylist.New(),
+		Limit:       100, //resizeme
+		Autosave:    true,
+		Enabled:     true,
+		StorePastes: true,
 	}
 
 	err := h.Init()
@@ -36,6 +140,19 @@ func NewHistory() (*History, error) {
 	return h, nil
 }
 
+// NewStoreHistory returns a History that keeps its entries in s, starting
+// after the newest entry already there.
+func NewStoreHistory(s HistoryStore) *History {
+	return &History{
+		Buf:         arraylist.New(),
+		Limit:       100,
+		Enabled:     true,
+		StorePastes: true,
+		Store:       s,
+		Pos:         s.Size(),
+	}
+}
+
 func (h *History) Init() error {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -45,8 +162,13 @@ func (h *History) Init() error {
 	path := filepath.Join(home, ".ollama", "history")
 	h.Filename = path
 
+	return h.load()
+}
+
+// load reads the entries from the history file.
+func (h *History) load() error {
 	//todo check if the file exists
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	f, err := os.OpenFile(h.Filename, os.O_CREATE|os.O_RDONLY, 0600)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil
@@ -55,78 +177,496 @@ func (h *History) Init() error {
 	}
 	defer f.Close()
 
-	r := bufio.NewReader(f)
-	for {
-		line, err := r.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
+	entries, err := readEntries(f)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		h.store(e.line, e.ts)
+	}
+	h.Compact()
+	h.Pos = h.Size()
+	return nil
+}
+
+// historyHeader starts a history file whose entries are escaped, with
+// backslashes doubled, a backslash at the end of each line of an entry but
+// the last, and a backslash before a # starting an entry so it isn't taken
+// for a timestamp. In a file without it each line is an entry as it is.
+const historyHeader = "#history 2"
+
+// readEntries reads the entries of a history file. Timestamp lines are
+// optional so files saved with or without them can be read.
+func readEntries(r io.Reader) ([]historyEntry, error) {
+	var entries []historyEntry
+	var ts int64
+	var lines []string
+	var escaped bool
+	br := bufio.NewReader(r)
+	for first := true; ; first = false {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			break
 		}
 
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
+		// only the newline is taken off, so pasted code keeps its indentation
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if first && line == historyHeader {
+			escaped = true
 			continue
 		}
 
-		h.Add([]rune(line))
+		// an empty line is only an entry as the last line of one
+		if len(line) == 0 && len(lines) == 0 {
+			continue
+		}
+
+		if t, ok := parseTimestamp(line); ok && len(lines) == 0 {
+			ts = t
+			continue
+		}
+
+		if escaped {
+			if len(lines) == 0 && strings.HasPrefix(line, `\#`) {
+				line = line[1:]
+			}
+
+			// an odd number of backslashes ends with one that isn't escaped
+			more := (len(line)-len(strings.TrimRight(line, `\`)))%2 == 1
+			if more {
+				line = line[:len(line)-1]
+			}
+			line = strings.ReplaceAll(line, `\\`, `\`)
+			if more {
+				lines = append(lines, line)
+				continue
+			}
+		}
+
+		entries = append(entries, historyEntry{[]rune(strings.Join(append(lines, line), "\n")), ts})
+		lines, ts = nil, 0
 	}
 
-	return nil
+	return entries, nil
 }
 
+// looksSpecial reports whether an entry would be read back as a timestamp
+// or the header if it were saved as it is.
+func looksSpecial(entry string) bool {
+	_, ok := parseTimestamp(entry)
+	return ok || entry == historyHeader
+}
+
+func parseTimestamp(line string) (int64, bool) {
+	digits, ok := strings.CutPrefix(line, "#")
+	if !ok {
+		return 0, false
+	}
+	ts, err := strconv.ParseInt(digits, 10, 64)
+	return ts, err == nil
+}
+
+// Add adds l as the newest entry and moves Pos to the end, as for a line
+// that's just been submitted.
 func (h *History) Add(l []rune) {
-	h.Buf.Add(l)
+	h.add(l, time.Now().Unix())
+}
+
+// Append adds s as the newest entry without moving Pos, for lines which
+// didn't come from Readline. A walk through the history carries on from the
+// same entry, and if there isn't one the next Prev returns s.
+func (h *History) Append(s string) {
+	atEnd := h.Pos >= h.Size()
+	before := h.Size()
+	if !h.store([]rune(s), time.Now().Unix()) {
+		return
+	}
+	h.track()
+	h.Compact()
+
+	if atEnd {
+		h.Pos = h.Size()
+	} else {
+		// entries dropped off the front move the rest down
+		h.Pos -= before + 1 - h.Size()
+		if h.Pos < 0 {
+			h.Pos = 0
+		}
+	}
+
+	if h.Autosave {
+		h.Save()
+	}
+}
+
+// add adds l and reports whether it was kept.
+func (h *History) add(l []rune, ts int64) bool {
+	if !h.store(l, ts) {
+		return false
+	}
+	h.track()
+
 	h.Compact()
 	h.Pos = h.Size()
 	if h.Autosave {
 		h.Save()
 	}
+	return true
+}
+
+// appendLast adds l to the newest entry on a line of its own, which is how
+// the lines of a paste are kept together. It's l that's checked with
+// CommentPrefix and Filter, so if it's rejected the entry is left as it was.
+func (h *History) appendLast(l []rune) {
+	l, ok := h.keep(l)
+	if !ok || h.Size() == 0 {
+		return
+	}
+
+	last := h.entry(h.Size() - 1)
+	l = append(append(append([]rune{}, last...), '\n'), l...)
+	if h.Store != nil {
+		h.Store.ReplaceLast(l)
+		h.Pos = h.Size()
+		return
+	}
+
+	if h.Shared {
+		h.untrack()
+	}
+	h.Buf.Set(h.Size()-1, l)
+	if len(h.times) == h.Size() {
+		h.times[h.Size()-1] = time.Now().Unix()
+	}
+	h.track()
+
+	h.Pos = h.Size()
+	if h.Autosave {
+		h.Save()
+	}
+}
+
+// keep returns l as it should be stored, after passing it through Filter, or
+// false if it's a comment or Filter rejects it.
+func (h *History) keep(l []rune) ([]rune, bool) {
+	if h.CommentPrefix != "" && strings.HasPrefix(string(l), h.CommentPrefix) {
+		return nil, false
+	}
+
+	if h.Filter != nil {
+		store, ok := h.Filter(string(l))
+		if !ok {
+			return nil, false
+		}
+		l = []rune(store)
+	}
+	return l, true
+}
+
+// store appends l unless keep rejects it, reporting whether it was kept.
+func (h *History) store(l []rune, ts int64) bool {
+	l, ok := h.keep(l)
+	if !ok {
+		return false
+	}
+
+	if h.Store != nil {
+		h.Store.Add(l)
+		return true
+	}
+
+	h.Buf.Add(l)
+	h.times = append(h.times, ts)
+	return true
+}
+
+// track keeps the newest entry to be saved with Shared.
+func (h *History) track() {
+	if !h.Shared || h.Store != nil {
+		return
+	}
+
+	var ts int64
+	if len(h.times) == h.Size() {
+		ts = h.times[h.Size()-1]
+	}
+	h.unsaved = append(h.unsaved, historyEntry{h.entry(h.Size() - 1), ts})
+}
+
+// untrack is called before the newest entry is replaced. If it's already
+// been saved it's taken out of the file the next time it's saved.
+func (h *History) untrack() {
+	if len(h.unsaved) > 0 {
+		h.unsaved = h.unsaved[:len(h.unsaved)-1]
+		return
+	}
+	h.replaced = append(h.replaced, h.entry(h.Size()-1))
+}
+
+// Load appends entries, oldest first, from somewhere other than the history
+// file. They're filtered like any other entry but aren't saved.
+func (h *History) Load(entries []string) {
+	for _, e := range entries {
+		h.store([]rune(e), 0)
+	}
+	h.Compact()
+	h.Pos = h.Size()
 }
 
 func (h *History) Compact() {
+	if h.Store != nil {
+		return
+	}
+
 	s := h.Buf.Size()
 	if s > h.Limit {
 		for cnt := 0; cnt < s-h.Limit; cnt++ {
 			h.Buf.Remove(0)
 		}
+		if len(h.times) > h.Limit {
+			h.times = h.times[len(h.times)-h.Limit:]
+		}
 	}
 }
 
+// Clear removes every entry from Buf. A Store has to be cleared itself.
 func (h *History) Clear() {
 	h.Buf.Clear()
+	h.times = nil
 }
 
 func (h *History) Prev() []rune {
-	var line []rune
-	if h.Pos > 0 {
-		h.Pos -= 1
+	if pos := h.prevShown(h.Pos); pos >= 0 {
+		h.Pos = pos
 	}
-	v, _ := h.Buf.Get(h.Pos)
-	line, _ = v.([]rune)
-	return line
+	return h.entry(h.Pos)
 }
 
 func (h *History) Next() []rune {
-	var line []rune
-	if h.Pos < h.Buf.Size() {
-		h.Pos += 1
-		v, _ := h.Buf.Get(h.Pos)
-		line, _ = v.([]rune)
+	if h.Pos < h.Size() {
+		h.Pos = h.nextShown(h.Pos)
+	}
+	return h.entry(h.Pos)
+}
+
+// SetFilter makes Prev and Next, and so the up and down arrows, skip over
+// entries that f returns false for until ClearFilter is called. Unlike
+// Filter it doesn't change what's stored.
+func (h *History) SetFilter(f func(entry string) bool) {
+	h.shown = f
+}
+
+// ClearFilter lets Prev and Next visit every entry again.
+func (h *History) ClearFilter() {
+	h.shown = nil
+}
+
+// visible reports whether Prev and Next stop at the entry at pos, which is
+// when it isn't filtered out and it matches the prefix with PrefixSearch.
+func (h *History) visible(pos int) bool {
+	if h.shown == nil && !h.PrefixSearch {
+		return true
+	}
+
+	entry := string(h.entry(pos))
+	if h.shown != nil && !h.shown(entry) {
+		return false
+	}
+
+	switch {
+	case !h.PrefixSearch:
+		return true
+	case h.PrefixMatch != nil:
+		return h.PrefixMatch(h.prefix, entry)
+	}
+	if h.fold(h.prefix) {
+		return strings.HasPrefix(strings.ToLower(entry), strings.ToLower(h.prefix))
+	}
+	return strings.HasPrefix(entry, h.prefix)
+}
+
+// searcher returns the store if it can do PrefixSearch itself, which is when
+// nothing else decides which entries are shown.
+func (h *History) searcher() (HistorySearcher, bool) {
+	s, ok := h.Store.(HistorySearcher)
+	if !ok || !h.PrefixSearch || h.shown != nil || h.PrefixMatch != nil {
+		return nil, false
+	}
+	return s, true
+}
+
+// prevShown returns the newest entry before pos that isn't filtered out, or
+// -1 if there isn't one.
+func (h *History) prevShown(pos int) int {
+	if s, ok := h.searcher(); ok {
+		if pos, ok := s.SearchPrefix(h.prefix, pos-1, false, h.fold(h.prefix)); ok {
+			return pos
+		}
+		return -1
+	}
+
+	for pos -= 1; pos >= 0; pos -= 1 {
+		if h.visible(pos) {
+			return pos
+		}
+	}
+	return -1
+}
+
+// nextShown returns the oldest entry after pos that isn't filtered out, or
+// Size if there isn't one.
+func (h *History) nextShown(pos int) int {
+	if s, ok := h.searcher(); ok {
+		if pos, ok := s.SearchPrefix(h.prefix, pos+1, true, h.fold(h.prefix)); ok {
+			return pos
+		}
+		return h.Size()
 	}
+
+	for pos += 1; pos < h.Size(); pos += 1 {
+		if h.visible(pos) {
+			return pos
+		}
+	}
+	return h.Size()
+}
+
+// entry returns the entry at n, or nil past the newest.
+func (h *History) entry(n int) []rune {
+	if h.Store != nil {
+		if n < 0 || n >= h.Store.Size() {
+			return nil
+		}
+		return h.Store.Entry(n)
+	}
+
+	v, _ := h.Buf.Get(n)
+	line, _ := v.([]rune)
 	return line
 }
 
+// Match reports whether line contains query, honouring SearchCase.
+func (h *History) Match(query, line string) bool {
+	if !h.fold(query) {
+		return strings.Contains(line, query)
+	}
+	return strings.Contains(strings.ToLower(line), strings.ToLower(query))
+}
+
+// fold reports whether SearchCase says to ignore case when looking for query.
+func (h *History) fold(query string) bool {
+	switch h.SearchCase {
+	case SearchCaseSensitive:
+		return false
+	case SearchCaseSmart:
+		for _, r := range query {
+			if unicode.IsUpper(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Search returns the index of the first entry matching query, starting at
+// start and moving towards older entries, or newer entries if forward is set.
+func (h *History) Search(query string, start int, forward bool) (int, bool) {
+	if s, ok := h.Store.(HistorySearcher); ok {
+		if start < 0 || start >= h.Size() {
+			return -1, false
+		}
+		return s.Search(query, start, forward, h.fold(query))
+	}
+
+	step := -1
+	if forward {
+		step = 1
+	}
+
+	for cnt := start; cnt >= 0 && cnt < h.Size(); cnt += step {
+		if h.Match(query, string(h.entry(cnt))) {
+			return cnt, true
+		}
+	}
+	return -1, false
+}
+
 func (h *History) Size() int {
+	if h.Store != nil {
+		return h.Store.Size()
+	}
 	return h.Buf.Size()
 }
 
 func (h *History) Save() error {
-	if !h.Enabled {
+	if !h.Enabled || h.Store != nil {
 		return nil
 	}
 
+	if h.Shared {
+		return h.saveShared()
+	}
+
+	entries := make([]historyEntry, h.Size())
+	for cnt := range entries {
+		entries[cnt].line = h.entry(cnt)
+		if cnt < len(h.times) {
+			entries[cnt].ts = h.times[cnt]
+		}
+	}
+	return h.write(entries)
+}
+
+// saveShared adds the entries added since the last save to the end of the
+// history file, holding a lock on it so another session saving at the same
+// time waits its turn. The lock is on a file of its own, since the history
+// file is replaced rather than written to.
+func (h *History) saveShared() error {
+	unlock, err := lockFile(h.Filename + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var entries []historyEntry
+	if f, err := os.Open(h.Filename); err == nil {
+		entries, err = readEntries(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// the newest of them that's the same is taken to be the one saved here
+	for _, line := range h.replaced {
+		for cnt := len(entries) - 1; cnt >= 0; cnt-- {
+			if string(entries[cnt].line) == string(line) {
+				entries = append(entries[:cnt], entries[cnt+1:]...)
+				break
+			}
+		}
+	}
+
+	entries = append(entries, h.unsaved...)
+	if len(entries) > h.Limit {
+		entries = entries[len(entries)-h.Limit:]
+	}
+
+	if err := h.write(entries); err != nil {
+		return err
+	}
+	h.unsaved, h.replaced = nil, nil
+	return nil
+}
+
+// write replaces the history file with entries.
+func (h *History) write(entries []historyEntry) error {
 	tmpFile := h.Filename + ".tmp"
 
 	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0666)
@@ -135,11 +675,30 @@ func (h *History) Save() error {
 	}
 	defer f.Close()
 
+	// entries are only escaped if they need to be, so a file of one line
+	// entries reads the same either way
+	var escaped bool
+	for _, e := range entries {
+		escaped = escaped || strings.ContainsAny(string(e.line), "\\\n") || looksSpecial(string(e.line))
+	}
+
 	buf := bufio.NewWriter(f)
-	for cnt := 0; cnt < h.Size(); cnt++ {
-		v, _ := h.Buf.Get(cnt)
-		line, _ := v.([]rune)
-		buf.WriteString(string(line) + "\n")
+	if escaped {
+		buf.WriteString(historyHeader + "\n")
+	}
+	for _, e := range entries {
+		if h.Timestamps && e.ts != 0 {
+			buf.WriteString("#" + strconv.FormatInt(e.ts, 10) + "\n")
+		}
+		line := string(e.line)
+		if escaped {
+			line = strings.ReplaceAll(line, `\`, `\\`)
+			line = strings.ReplaceAll(line, "\n", "\\\n")
+			if strings.HasPrefix(line, "#") {
+				line = `\` + line
+			}
+		}
+		buf.WriteString(line + "\n")
 	}
 	buf.Flush()
 	f.Close()
@@ -0,0 +1,894 @@
+package readline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emirpasic/gods/lists/arraylist"
+)
+
+func newTestHistory(entries ...string) *History {
+	h := &History{
+		Buf:         arraylist.New(),
+		Limit:       100,
+		Enabled:     true,
+		StorePastes: true,
+	}
+	for _, e := range entries {
+		h.Add([]rune(e))
+	}
+	return h
+}
+
+func TestHistorySearchCase(t *testing.T) {
+	h := newTestHistory("git status", "Git commit", "GIT push")
+
+	type testCase struct {
+		mode  SearchCase
+		query string
+		want  []int
+	}
+
+	testCases := map[string]testCase{
+		"insensitive lower": {SearchCaseInsensitive, "git", []int{2, 1, 0}},
+		"insensitive upper": {SearchCaseInsensitive, "Git", []int{2, 1, 0}},
+		"sensitive lower":   {SearchCaseSensitive, "git", []int{0}},
+		"sensitive upper":   {SearchCaseSensitive, "Git", []int{1}},
+		"smart lower":       {SearchCaseSmart, "git", []int{2, 1, 0}},
+		"smart upper":       {SearchCaseSmart, "Git", []int{1}},
+		"smart all upper":   {SearchCaseSmart, "GIT", []int{2}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h.SearchCase = v.mode
+
+			var got []int
+			for pos, ok := h.Search(v.query, h.Size()-1, false); ok; pos, ok = h.Search(v.query, pos-1, false) {
+				got = append(got, pos)
+			}
+
+			if len(got) != len(v.want) {
+				t.Fatalf("expected %v, got %v", v.want, got)
+			}
+			for idx := range got {
+				if got[idx] != v.want[idx] {
+					t.Fatalf("expected %v, got %v", v.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	type testCase struct {
+		filter func(string) (string, bool)
+		expect []string
+	}
+
+	testCases := map[string]*testCase{
+		"passthrough": {
+			filter: func(e string) (string, bool) { return e, true },
+			expect: []string{"x", "ls", "token=abc123"},
+		},
+		"reject": {
+			filter: func(e string) (string, bool) { return e, len(e) > 1 },
+			expect: []string{"ls", "token=abc123"},
+		},
+		"transform": {
+			filter: func(e string) (string, bool) {
+				if k, _, ok := strings.Cut(e, "="); ok {
+					return k + "=<redacted>", true
+				}
+				return e, true
+			},
+			expect: []string{"x", "ls", "token=<redacted>"},
+		},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := newTestHistory()
+			h.Filename = filepath.Join(t.TempDir(), "history")
+			h.Autosave = true
+			h.Filter = v.filter
+
+			for _, e := range []string{"x", "ls", "token=abc123"} {
+				h.Add([]rune(e))
+			}
+
+			var got []string
+			for cnt := 0; cnt < h.Size(); cnt++ {
+				v, _ := h.Buf.Get(cnt)
+				got = append(got, string(v.([]rune)))
+			}
+
+			if strings.Join(got, "\n") != strings.Join(v.expect, "\n") {
+				t.Fatalf("expected %q, got %q", v.expect, got)
+			}
+
+			saved, err := os.ReadFile(h.Filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(saved) != strings.Join(v.expect, "\n")+"\n" {
+				t.Fatalf("expected saved %q, got %q", v.expect, saved)
+			}
+		})
+	}
+}
+
+func TestHistoryTimestamps(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(filename, []byte("old\n#1700000000\nls -l\n#notatime\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHistory()
+	h.Filename = filename
+	h.Timestamps = true
+	if err := h.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Add([]rune("pwd"))
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for cnt := 0; cnt < h.Size(); cnt++ {
+		v, _ := h.Buf.Get(cnt)
+		got = append(got, string(v.([]rune)))
+	}
+
+	expect := []string{"old", "ls -l", "#notatime", "pwd"}
+	if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+		t.Fatalf("expected %q, got %q", expect, got)
+	}
+
+	saved, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(saved), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 lines, got %q", lines)
+	}
+
+	if strings.Join(lines[:4], "\n") != "old\n#1700000000\nls -l\n#notatime" {
+		t.Fatalf("expected existing entries to keep their timestamps, got %q", lines)
+	}
+
+	if _, ok := parseTimestamp(lines[4]); !ok || lines[5] != "pwd" {
+		t.Fatalf("expected a timestamp before the new entry, got %q", lines[4:])
+	}
+
+	// loading again gives the same entries
+	reload := newTestHistory()
+	reload.Filename = filename
+	if err := reload.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if reload.Size() != len(expect) {
+		t.Fatalf("expected %d entries, got %d", len(expect), reload.Size())
+	}
+}
+
+func TestHistoryLoad(t *testing.T) {
+	// typed slowly so each step through the history is drawn
+	i, out := newTestInstance("")
+	i.Terminal = newTerminal(&slowReader{data: "\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\r\x1b[A\r", delay: 5 * time.Millisecond}, out)
+	i.History.Load([]string{"one", "two", "three", "four", "five"})
+
+	if i.History.Pos != 5 {
+		t.Fatalf("expected history position 5, got %d", i.History.Pos)
+	}
+
+	var got []string
+	i.OnChange = func(line string, pos int) {
+		got = append(got, line)
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "one" {
+		t.Fatalf("expected %q, got %q", "one", line)
+	}
+
+	want := []string{"five", "four", "three", "two", "one"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// new entries go after the seeded ones
+	if i.History.Size() != 6 {
+		t.Fatalf("expected 6 history entries, got %d", i.History.Size())
+	}
+
+	if line, _ := i.Readline(); line != "one" {
+		t.Fatalf("expected %q, got %q", "one", line)
+	}
+}
+
+func TestHistoryCommentPrefix(t *testing.T) {
+	testCases := map[string][]string{
+		"":   {"# setup", "ls", "#done"},
+		"#":  {"ls"},
+		"//": {"# setup", "ls", "#done"},
+	}
+
+	for prefix, expect := range testCases {
+		i, _ := newTestInstance("# setup\rls\r#done\r")
+		i.History.CommentPrefix = prefix
+
+		for _, want := range []string{"# setup", "ls", "#done"} {
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != want {
+				t.Fatalf("expected %q, got %q", want, line)
+			}
+		}
+
+		var got []string
+		for cnt := 0; cnt < i.History.Size(); cnt++ {
+			got = append(got, string(i.History.entry(cnt)))
+		}
+
+		if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+			t.Fatalf("prefix %q: expected %q, got %q", prefix, expect, got)
+		}
+	}
+}
+
+func TestHistoryStorePastes(t *testing.T) {
+	for _, store := range []bool{false, true} {
+		i, _ := newTestInstance("before\r\x1b[200~line one\rline two\x1b[201~\rafter\r")
+		i.History.StorePastes = store
+
+		for _, expect := range []string{"before", `"""line one`, `line two"""`, "after"} {
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != expect {
+				t.Fatalf("expected %q, got %q", expect, line)
+			}
+		}
+
+		var got []string
+		for cnt := 0; cnt < i.History.Size(); cnt++ {
+			got = append(got, string(i.History.entry(cnt)))
+		}
+
+		expect := []string{"before", "after"}
+		if store {
+			expect = []string{"before", "\"\"\"line one\nline two\"\"\"", "after"}
+		}
+
+		if strings.Join(got, "|") != strings.Join(expect, "|") {
+			t.Fatalf("store %t: expected %q, got %q", store, expect, got)
+		}
+	}
+}
+
+func TestWrapPaste(t *testing.T) {
+	type testCase struct {
+		raw     bool
+		expect  []string
+		entries string
+	}
+
+	testCases := map[string]*testCase{
+		"wrapped":   {false, []string{"before", `"""line one`, `line two"""`, "after"}, "before|\"\"\"line one\nline two\"\"\"|after"},
+		"unwrapped": {true, []string{"before", "line one", "line two", "after"}, "before|line one\nline two|after"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance("before\r\x1b[200~line one\rline two\x1b[201~\rafter\r")
+			i.RawPaste = v.raw
+
+			for _, expect := range v.expect {
+				line, err := i.Readline()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if line != expect {
+					t.Fatalf("expected %q, got %q", expect, line)
+				}
+			}
+
+			// the paste is one entry, just as it was returned
+			expect := v.entries
+			var got []string
+			for cnt := 0; cnt < i.History.Size(); cnt++ {
+				got = append(got, string(i.History.entry(cnt)))
+			}
+
+			if strings.Join(got, "|") != expect {
+				t.Fatalf("expected %q, got %q", expect, got)
+			}
+		})
+	}
+}
+
+func TestHistoryMultiLineFile(t *testing.T) {
+	h := newTestHistory("ls", "line one\nline two", "pwd")
+	h.Filename = filepath.Join(t.TempDir(), "history")
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(h.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := historyHeader + "\nls\nline one\\\nline two\npwd\n"; string(saved) != expect {
+		t.Fatalf("expected %q, got %q", expect, saved)
+	}
+
+	reload := newTestHistory()
+	reload.Filename = h.Filename
+	if err := reload.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if reload.Size() != 3 || string(reload.entry(1)) != "line one\nline two" {
+		t.Fatalf("expected the entry to be read back as one, got %d entries", reload.Size())
+	}
+}
+
+func TestHistoryFileEscapes(t *testing.T) {
+	testCases := map[string][]string{
+		"trailing backslash": {"echo foo \\", "ls"},
+		"backslashes":        {`C:\dir\\share`, `\\`, "ls"},
+		"indented":           {"def f():\n    return 1\n", "  ls"},
+		"blank lines":        {"one\n\ntwo", "", "ls"},
+		"backslash line":     {"one \\\ntwo", "ls"},
+		"timestamp entry":    {"#42", "ls", "#"},
+		"header entry":       {historyHeader, "ls"},
+		"hashes":             {"#42", "ls", "#", `\#x`, "# one\n#7"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			h := newTestHistory(v...)
+			h.Filename = filepath.Join(t.TempDir(), "history")
+			if err := h.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			// an empty entry is never added
+			var expect []string
+			for _, e := range v {
+				if e != "" {
+					expect = append(expect, e)
+				}
+			}
+
+			if got := savedEntries(t, h.Filename); !reflect.DeepEqual(got, expect) {
+				t.Fatalf("expected %q, got %q", expect, got)
+			}
+		})
+	}
+}
+
+func TestHistoryHashTimestamps(t *testing.T) {
+	// entries that look like timestamps are kept along with the real ones
+	h := newTestHistory()
+	h.Timestamps = true
+	h.Filename = filepath.Join(t.TempDir(), "history")
+	for _, e := range []string{"#42", "ls", "#7\n#8"} {
+		h.Add([]rune(e))
+	}
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(h.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries, err := readEntries(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"#42", "ls", "#7\n#8"}
+	if len(entries) != len(expect) {
+		t.Fatalf("expected %q, got %v", expect, entries)
+	}
+	for idx, e := range entries {
+		if string(e.line) != expect[idx] || e.ts == 0 {
+			t.Fatalf("expected %q with a timestamp, got %q at %d", expect[idx], string(e.line), e.ts)
+		}
+	}
+}
+
+func TestHistoryUnescapedFile(t *testing.T) {
+	// a file saved before entries were escaped has an entry on every line
+	filename := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(filename, []byte("echo foo \\\n  ls\nC:\\\\share\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{"echo foo \\", "  ls", `C:\\share`}
+	if got := savedEntries(t, filename); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %q, got %q", expect, got)
+	}
+}
+
+func TestHistoryPasteFiltered(t *testing.T) {
+	h := newTestHistory("one")
+	h.CommentPrefix = "#"
+
+	// a line of a paste that's rejected leaves the lines before it
+	h.appendLast([]rune("two"))
+	h.appendLast([]rune("# three"))
+	h.appendLast([]rune("four"))
+
+	if got := string(h.entry(h.Size() - 1)); got != "one\ntwo\nfour" {
+		t.Fatalf("expected %q, got %q", "one\ntwo\nfour", got)
+	}
+}
+
+func newSharedHistory(filename string) *History {
+	h := newTestHistory()
+	h.Filename = filename
+	h.Autosave = true
+	h.Shared = true
+	return h
+}
+
+// savedEntries returns the entries in the history file.
+func savedEntries(t *testing.T, filename string) []string {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	entries, err := readEntries(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, string(e.line))
+	}
+	return lines
+}
+
+func TestHistoryShared(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(filename, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := newSharedHistory(filename), newSharedHistory(filename)
+	for _, h := range []*History{a, b} {
+		if err := h.load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a.Add([]rune("a1"))
+	b.Add([]rune("b1"))
+	a.Add([]rune("a2"))
+	b.Add([]rune("b2"))
+
+	// saving again with nothing new doesn't add anything twice
+	for _, h := range []*History{a, b} {
+		if err := h.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if expect := []string{"old", "a1", "b1", "a2", "b2"}; !reflect.DeepEqual(savedEntries(t, filename), expect) {
+		t.Fatalf("expected %q, got %q", expect, savedEntries(t, filename))
+	}
+
+	// each keeps its own entries until it loads the file again
+	if a.Size() != 3 || b.Size() != 3 {
+		t.Fatalf("expected 3 entries each, got %d and %d", a.Size(), b.Size())
+	}
+}
+
+func TestHistorySharedConcurrent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+
+	done := make(chan bool)
+	for _, name := range []string{"a", "b"} {
+		go func(name string) {
+			h := newSharedHistory(filename)
+			for cnt := 0; cnt < 20; cnt++ {
+				h.Add([]rune(fmt.Sprintf("%s%d", name, cnt)))
+			}
+			done <- true
+		}(name)
+	}
+	<-done
+	<-done
+
+	saved := savedEntries(t, filename)
+	if len(saved) != 40 {
+		t.Fatalf("expected 40 entries, got %d: %q", len(saved), saved)
+	}
+}
+
+func TestHistorySharedLimit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	a, b := newSharedHistory(filename), newSharedHistory(filename)
+	a.Limit, b.Limit = 3, 3
+
+	a.Add([]rune("a1"))
+	b.Add([]rune("b1"))
+	a.Add([]rune("a2"))
+	b.Add([]rune("b2"))
+
+	if expect := []string{"b1", "a2", "b2"}; !reflect.DeepEqual(savedEntries(t, filename), expect) {
+		t.Fatalf("expected %q, got %q", expect, savedEntries(t, filename))
+	}
+}
+
+func TestHistorySharedPaste(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history")
+	a, b := newSharedHistory(filename), newSharedHistory(filename)
+
+	// the lines of a paste replace the entry they've been saved in so far
+	a.Add([]rune("one"))
+	b.Add([]rune("other"))
+	a.appendLast([]rune("two"))
+	a.appendLast([]rune("three"))
+
+	if expect := []string{"other", "one\ntwo\nthree"}; !reflect.DeepEqual(savedEntries(t, filename), expect) {
+		t.Fatalf("expected %q, got %q", expect, savedEntries(t, filename))
+	}
+}
+
+func TestHistoryAppend(t *testing.T) {
+	h := newTestHistory("one", "two", "three")
+
+	// while not walking through the history the next step back is the new entry
+	h.Append("external")
+	if h.Pos != h.Size() {
+		t.Fatalf("expected history position %d, got %d", h.Size(), h.Pos)
+	}
+
+	if got := string(h.Prev()); got != "external" {
+		t.Fatalf("expected %q, got %q", "external", got)
+	}
+
+	// part way through it carries on from the same entry
+	h.Prev()
+	h.Append("another")
+	if got := string(h.Prev()); got != "two" {
+		t.Fatalf("expected %q, got %q", "two", got)
+	}
+
+	// entries dropping off the front don't change where it's at
+	h.Limit = h.Size()
+	h.Append("last")
+	if got := string(h.Next()); got != "three" {
+		t.Fatalf("expected %q, got %q", "three", got)
+	}
+
+	var got []string
+	for cnt := 0; cnt < h.Size(); cnt++ {
+		got = append(got, string(h.entry(cnt)))
+	}
+
+	expect := []string{"two", "three", "external", "another", "last"}
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestHistoryAppendReadline(t *testing.T) {
+	i, _ := newTestInstance("\x1b[A\r")
+	i.History = newTestHistory("one", "two")
+	i.History.Append("from a flag")
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "from a flag" {
+		t.Fatalf("expected %q, got %q", "from a flag", line)
+	}
+}
+
+func TestPauseHistory(t *testing.T) {
+	i, _ := newTestInstance("one\rtwo\rthree\rfour\rfive\r")
+	i.History = newTestHistory()
+
+	read := func() {
+		if _, err := i.Readline(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read()
+	i.PauseHistory()
+	i.PauseHistory()
+	read()
+	i.ResumeHistory()
+	read()
+	i.ResumeHistory()
+	read()
+	// resuming once too often doesn't cancel out the next pause
+	i.ResumeHistory()
+	if _, err := i.WithoutHistory(i.Readline); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []string
+	for cnt := 0; cnt < i.History.Size(); cnt++ {
+		entries = append(entries, string(i.History.entry(cnt)))
+	}
+
+	if expect := []string{"one", "four"}; !reflect.DeepEqual(entries, expect) {
+		t.Fatalf("expected %q, got %q", expect, entries)
+	}
+
+	if !i.History.Enabled {
+		t.Fatalf("expected the history to stay enabled")
+	}
+}
+
+func TestHistoryPrefixSearch(t *testing.T) {
+	// a leading word, such as sudo, is ignored
+	ignoreWord := func(prefix, entry string) bool {
+		_, rest, _ := strings.Cut(entry, " ")
+		return strings.HasPrefix(entry, prefix) || strings.HasPrefix(rest, prefix)
+	}
+
+	type testCase struct {
+		match  func(prefix, entry string) bool
+		input  string
+		expect string
+		search SearchCase
+	}
+
+	testCases := map[string]*testCase{
+		"literal":             {nil, "apt\x1b[A\r", "apt list", SearchCaseInsensitive},
+		"literal no more":     {nil, "apt\x1b[A\x1b[A\r", "apt list", SearchCaseInsensitive},
+		"literal empty":       {nil, "\x1b[A\x1b[A\r", "sudo apt install", SearchCaseInsensitive},
+		"ignore case":         {nil, "APT\x1b[A\r", "apt list", SearchCaseInsensitive},
+		"sensitive":           {nil, "APT\x1b[A\r", "APT", SearchCaseSensitive},
+		"smart upper":         {nil, "Sudo\x1b[A\r", "Sudo", SearchCaseSmart},
+		"smart lower":         {nil, "sudo\x1b[A\r", "sudo apt install", SearchCaseSmart},
+		"ignore word":         {ignoreWord, "apt\x1b[A\r", "apt list", SearchCaseInsensitive},
+		"ignore word older":   {ignoreWord, "apt\x1b[A\x1b[A\r", "sudo apt install", SearchCaseInsensitive},
+		"ignore word oldest":  {ignoreWord, "apt\x1b[A\x1b[A\x1b[A\x1b[A\r", "sudo apt update", SearchCaseInsensitive},
+		"ignore word back":    {ignoreWord, "apt\x1b[A\x1b[A\x1b[A\x1b[B\r", "sudo apt install", SearchCaseInsensitive},
+		"ignore word typed":   {ignoreWord, "apt\x1b[A\x1b[A\x1b[B\x1b[B\r", "apt", SearchCaseInsensitive},
+		"prefix from the end": {ignoreWord, "apt\x1b[A\x7f\x7f\x7f\x7f\x7f\x7f\x7f\x7f\x1b[A\r", "sudo apt install", SearchCaseInsensitive},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.History = newTestHistory("sudo apt update", "ls", "sudo apt install", "apt list")
+			i.History.PrefixSearch = true
+			i.History.PrefixMatch = v.match
+			i.History.SearchCase = v.search
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
+
+func TestHistorySetFilter(t *testing.T) {
+	h := newTestHistory("docker ps", "ls", "docker build", "pwd")
+	h.SetFilter(func(e string) bool {
+		return strings.HasPrefix(e, "docker")
+	})
+
+	var got []string
+	for cnt := 0; cnt < 3; cnt++ {
+		got = append(got, string(h.Prev()))
+	}
+	for cnt := 0; cnt < 2; cnt++ {
+		got = append(got, string(h.Next()))
+	}
+
+	expect := []string{"docker build", "docker ps", "docker ps", "docker build", ""}
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected %q, got %q", expect, got)
+	}
+
+	h.ClearFilter()
+	got = nil
+	for cnt := 0; cnt < 4; cnt++ {
+		got = append(got, string(h.Prev()))
+	}
+
+	expect = []string{"pwd", "docker build", "ls", "docker ps"}
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected %q, got %q", expect, got)
+	}
+}
+
+func TestHistorySetFilterReadline(t *testing.T) {
+	i, out := newTestInstance("")
+	i.Terminal = newTerminal(&slowReader{data: "draft\x1b[A\x1b[A\x1b[A\x1b[B\x1b[B\r", delay: 5 * time.Millisecond}, out)
+	i.History = newTestHistory("docker ps", "ls", "docker build", "pwd")
+	i.History.SetFilter(func(e string) bool {
+		return strings.Contains(e, "docker")
+	})
+
+	var got []string
+	i.OnChange = func(line string, pos int) {
+		got = append(got, line)
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "draft" {
+		t.Fatalf("expected %q, got %q", "draft", line)
+	}
+
+	// the oldest match stays put and going down past the newest gets the
+	// typed line back
+	expect := []string{"d", "dr", "dra", "draf", "draft", "docker build", "docker ps", "docker build", "draft"}
+	if strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected %q, got %q", expect, got)
+	}
+}
+
+// fakeStore is a HistoryStore that records what's done to it.
+type fakeStore struct {
+	entries [][]rune
+	reads   []int    // the entries asked for
+	changes []string // what's been added and replaced
+}
+
+func (s *fakeStore) Add(line []rune) {
+	s.changes = append(s.changes, "add "+string(line))
+	s.entries = append(s.entries, line)
+}
+
+func (s *fakeStore) ReplaceLast(line []rune) {
+	s.changes = append(s.changes, "replace "+string(line))
+	s.entries[len(s.entries)-1] = line
+}
+
+func (s *fakeStore) Size() int {
+	return len(s.entries)
+}
+
+func (s *fakeStore) Entry(n int) []rune {
+	s.reads = append(s.reads, n)
+	return s.entries[n]
+}
+
+func TestHistoryStore(t *testing.T) {
+	store := &fakeStore{entries: [][]rune{[]rune("one"), []rune("two")}}
+	i, _ := newTestInstance("\x1b[A\x1b[A\x1b[B!\r\x1b[200~a\rb\x1b[201~\r\x12on\r")
+	i.History = NewStoreHistory(store)
+
+	for _, expect := range []string{"two!", `"""a`, `b"""`, "one"} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+
+	// up twice and down again, before searching reads more
+	if len(store.reads) < 3 || fmt.Sprint(store.reads[:3]) != "[1 0 1]" {
+		t.Fatalf("expected entries 1, 0 and 1 to be recalled, got %v", store.reads)
+	}
+
+	expect := []string{"add two!", `add """a`, "replace \"\"\"a\nb\"\"\"", "add one"}
+	if strings.Join(store.changes, "|") != strings.Join(expect, "|") {
+		t.Fatalf("expected %q, got %q", expect, store.changes)
+	}
+
+	if i.History.Pos != store.Size() {
+		t.Fatalf("expected history position %d, got %d", store.Size(), i.History.Pos)
+	}
+}
+
+// fakeSearcher is a fakeStore that searches its own entries.
+type fakeSearcher struct {
+	fakeStore
+	searches []string
+}
+
+func (s *fakeSearcher) Search(query string, start int, forward, fold bool) (int, bool) {
+	s.searches = append(s.searches, fmt.Sprintf("search %s %d %t %t", query, start, forward, fold))
+	return s.find(start, forward, func(entry string) bool { return strings.Contains(entry, query) })
+}
+
+func (s *fakeSearcher) SearchPrefix(prefix string, start int, forward, fold bool) (int, bool) {
+	s.searches = append(s.searches, fmt.Sprintf("prefix %s %d %t %t", prefix, start, forward, fold))
+	return s.find(start, forward, func(entry string) bool { return strings.HasPrefix(entry, prefix) })
+}
+
+func (s *fakeSearcher) find(start int, forward bool, match func(string) bool) (int, bool) {
+	step := -1
+	if forward {
+		step = 1
+	}
+
+	for cnt := start; cnt >= 0 && cnt < len(s.entries); cnt += step {
+		if match(string(s.entries[cnt])) {
+			return cnt, true
+		}
+	}
+	return -1, false
+}
+
+func TestHistorySearcher(t *testing.T) {
+	store := &fakeSearcher{fakeStore: fakeStore{entries: [][]rune{[]rune("one"), []rune("two"), []rune("three")}}}
+	i, _ := newTestInstance("t\x1b[A\x1b[A\x1b[B\x1b[B\r\x12on\r")
+	i.History = NewStoreHistory(store)
+	i.History.PrefixSearch = true
+
+	for _, expect := range []string{"t", "one"} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+
+	expect := []string{
+		"prefix t 2 false true",
+		"prefix t 2 false true",
+		"prefix t 1 false true",
+		"prefix t 1 false true",
+		"prefix t 2 true true",
+		"prefix t 3 true true",
+		"search o 3 false true",
+		"search on 1 false true",
+	}
+	if strings.Join(store.searches, "|") != strings.Join(expect, "|") {
+		t.Fatalf("expected %q, got %q", expect, store.searches)
+	}
+
+	// only the entries that were recalled or found are read
+	if fmt.Sprint(store.reads) != "[2 1 2 1 0 0]" {
+		t.Fatalf("expected entries [2 1 2 1 0 0] to be read, got %v", store.reads)
+	}
+}
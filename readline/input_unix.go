@@ -0,0 +1,87 @@
+//go:build aix || darwin || dragonfly || freebsd || (linux && !appengine) || netbsd || openbsd || os400 || solaris
+
+package readline
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// pollInterval is how long a read waits for input before checking whether
+// it's been paused
+const pollInterval = 100 * time.Millisecond
+
+// pollReader reads the terminal, waiting for input with poll so reading can
+// be paused in between. Nothing is read while it's paused, so something else,
+// such as an editor, can have the terminal.
+type pollReader struct {
+	fd int
+
+	mu     sync.Mutex // held while polling and reading
+	paused bool
+	closed bool
+}
+
+func newInput(f *os.File) io.Reader {
+	return &pollReader{fd: int(f.Fd())}
+}
+
+func (r *pollReader) Read(p []byte) (int, error) {
+	fds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN}}
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return 0, io.EOF
+		}
+		if r.paused {
+			r.mu.Unlock()
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		ready, err := unix.Poll(fds, int(pollInterval/time.Millisecond))
+		if err == nil && ready > 0 {
+			var n int
+			n, err = unix.Read(r.fd, p)
+			if err == nil {
+				r.mu.Unlock()
+				if n == 0 {
+					return 0, io.EOF
+				}
+				return n, nil
+			}
+		}
+		r.mu.Unlock()
+
+		if err != nil && err != unix.EINTR && err != unix.EAGAIN {
+			return 0, err
+		}
+	}
+}
+
+// pause waits for a read that's going on to finish and stops any more until
+// resume is called.
+func (r *pollReader) pause() {
+	r.mu.Lock()
+	r.paused = true
+	r.mu.Unlock()
+}
+
+func (r *pollReader) resume() {
+	r.mu.Lock()
+	r.paused = false
+	r.mu.Unlock()
+}
+
+// stop makes reads return io.EOF from the next time they check, within
+// pollInterval, so the goroutine reading doesn't wait for another key.
+func (r *pollReader) stop() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+}
@@ -0,0 +1,75 @@
+//go:build aix || darwin || dragonfly || freebsd || (linux && !appengine) || netbsd || openbsd || os400 || solaris
+
+package readline
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPollReaderPause(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	in := &pollReader{fd: int(r.Fd())}
+	in.pause()
+
+	got := make(chan string, 1)
+	go func() {
+		p := make([]byte, 8)
+		n, _ := in.Read(p)
+		got <- string(p[:n])
+	}()
+
+	// what arrives while paused is left for something else to read
+	w.Write([]byte("a"))
+	select {
+	case s := <-got:
+		t.Fatalf("expected nothing to be read while paused, got %q", s)
+	case <-time.After(3 * pollInterval):
+	}
+
+	p := make([]byte, 8)
+	if n, err := r.Read(p); err != nil || string(p[:n]) != "a" {
+		t.Fatalf("expected %q to be left, got %q and %v", "a", p[:n], err)
+	}
+
+	in.resume()
+	w.Write([]byte("b"))
+	select {
+	case s := <-got:
+		if s != "b" {
+			t.Fatalf("expected %q, got %q", "b", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a read after resuming")
+	}
+}
+
+func TestPollReaderClose(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	var out bytes.Buffer
+	term := newTerminal(&pollReader{fd: int(r.Fd())}, &out)
+
+	// give the reading goroutine time to start waiting
+	time.Sleep(pollInterval)
+	term.Close()
+
+	select {
+	case <-term.stopped:
+	case <-time.After(5 * pollInterval):
+		t.Fatal("expected the reading goroutine to stop after Close without another key")
+	}
+}
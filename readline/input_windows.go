@@ -0,0 +1,130 @@
+package readline
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pollInterval is how long a read waits for input before checking whether
+// it's been paused
+const pollInterval = 100 * time.Millisecond
+
+const keyEvent = 1
+
+var (
+	procPeekConsoleInput = kernel32.NewProc("PeekConsoleInputW")
+	procReadConsoleInput = kernel32.NewProc("ReadConsoleInputW")
+)
+
+// inputRecord is an INPUT_RECORD, with the event read as a
+// KEY_EVENT_RECORD, which is only meaningful when eventType is keyEvent.
+type inputRecord struct {
+	eventType   uint16
+	_           uint16
+	keyDown     int32
+	repeatCount uint16
+	keyCode     uint16
+	scanCode    uint16
+	char        uint16
+	controlKeys uint32
+}
+
+// pollReader reads the console, waiting for input on its handle so reading
+// can be paused in between. Nothing is read while it's paused, so something
+// else, such as an editor, can have the console. Reads go through f, which
+// reads the console as UTF-16 and gives UTF-8 whatever its code page is.
+type pollReader struct {
+	f *os.File
+	h windows.Handle
+
+	mu     sync.Mutex // held while waiting and reading
+	paused bool
+	closed bool
+}
+
+func newInput(f *os.File) io.Reader {
+	return &pollReader{f: f, h: windows.Handle(f.Fd())}
+}
+
+func (r *pollReader) Read(p []byte) (int, error) {
+	for {
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return 0, io.EOF
+		}
+		if r.paused {
+			r.mu.Unlock()
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		ready, err := r.wait()
+		if err == nil && ready {
+			n, err := r.f.Read(p)
+			r.mu.Unlock()
+			return n, err
+		}
+		r.mu.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// wait reports whether there's a key to read within pollInterval. The
+// console handle is also signalled for events that reading skips over, such
+// as focus changes and keys being let go, so those are taken off the queue
+// here, since reading would wait for a key after them.
+func (r *pollReader) wait() (bool, error) {
+	event, err := windows.WaitForSingleObject(r.h, uint32(pollInterval/time.Millisecond))
+	if err != nil || event != windows.WAIT_OBJECT_0 {
+		return false, err
+	}
+
+	var records [16]inputRecord
+	var n uint32
+	if ok, _, err := syscall.SyscallN(procPeekConsoleInput.Addr(), uintptr(r.h), uintptr(unsafe.Pointer(&records[0])), uintptr(len(records)), uintptr(unsafe.Pointer(&n))); ok == 0 {
+		return false, err
+	}
+
+	for _, record := range records[:n] {
+		if record.eventType == keyEvent && record.keyDown != 0 && record.char != 0 {
+			return true, nil
+		}
+	}
+
+	if ok, _, err := syscall.SyscallN(procReadConsoleInput.Addr(), uintptr(r.h), uintptr(unsafe.Pointer(&records[0])), uintptr(n), uintptr(unsafe.Pointer(&n))); ok == 0 {
+		return false, err
+	}
+	return false, nil
+}
+
+// pause waits for a read that's going on to finish and stops any more until
+// resume is called.
+func (r *pollReader) pause() {
+	r.mu.Lock()
+	r.paused = true
+	r.mu.Unlock()
+}
+
+func (r *pollReader) resume() {
+	r.mu.Lock()
+	r.paused = false
+	r.mu.Unlock()
+}
+
+// stop makes reads return io.EOF from the next time they check, within
+// pollInterval, so the goroutine reading doesn't wait for another key.
+func (r *pollReader) stop() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+}
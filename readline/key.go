@@ -0,0 +1,228 @@
+package readline
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyCode says which key a Key is.
+type KeyCode int
+
+const (
+	// CodeRune is a rune that was typed, including control characters such
+	// as CharEnter
+	CodeRune KeyCode = iota
+	// CodeEscape is escape on its own, when nothing followed it
+	CodeEscape
+	// CodeUnknown is an escape sequence that isn't recognised
+	CodeUnknown
+
+	CodeUp
+	CodeDown
+	CodeRight
+	CodeLeft
+	CodeHome
+	CodeEnd
+	CodeInsert
+	CodeDelete
+	CodePageUp
+	CodePageDown
+	CodeShiftTab
+
+	// CodePasteStart and CodePasteEnd surround a bracketed paste
+	CodePasteStart
+	CodePasteEnd
+)
+
+// Key is a key press decoded from what the terminal sent for it.
+type Key struct {
+	Code KeyCode
+	Rune rune // the rune for CodeRune
+
+	// Meta is set for a rune that came after escape, which is how most
+	// terminals send Alt. Shift, Ctrl and Meta are also set from the
+	// modifiers of keys such as Ctrl+Left.
+	Meta  bool
+	Shift bool
+	Ctrl  bool
+
+	// Seq is everything that was read for the key
+	Seq string
+}
+
+// IsRune reports whether k is r typed without any modifiers.
+func (k Key) IsRune(r rune) bool {
+	return k.Code == CodeRune && k.Rune == r && !k.Meta
+}
+
+// KnownSequences are the escape sequences DecodeKey recognises and the keys
+// they're decoded to. Sequences are listed without modifiers, which are taken
+// off before a sequence is looked up, so "\x1b[1;5D" for Ctrl+Left is found
+// as "\x1b[D", "\x1b[3;5~" for Ctrl+Delete as "\x1b[3~" and "\x1bO2A" for
+// Shift+Up as "\x1bOA". Entries can be added for other terminals before
+// Readline is called.
+var KnownSequences = map[string]Key{
+	// CSI and SS3 without parameters, SS3 being sent for the arrows in
+	// application mode
+	"\x1b[A": {Code: CodeUp},
+	"\x1b[B": {Code: CodeDown},
+	"\x1b[C": {Code: CodeRight},
+	"\x1b[D": {Code: CodeLeft},
+	"\x1b[H": {Code: CodeHome},
+	"\x1b[F": {Code: CodeEnd},
+	"\x1b[Z": {Code: CodeShiftTab},
+	"\x1bOA": {Code: CodeUp},
+	"\x1bOB": {Code: CodeDown},
+	"\x1bOC": {Code: CodeRight},
+	"\x1bOD": {Code: CodeLeft},
+	"\x1bOH": {Code: CodeHome},
+	"\x1bOF": {Code: CodeEnd},
+	"\x1bOZ": {Code: CodeShiftTab},
+
+	// rxvt's Shift and the arrows
+	"\x1b[a": {Code: CodeUp, Shift: true},
+	"\x1b[b": {Code: CodeDown, Shift: true},
+	"\x1b[c": {Code: CodeRight, Shift: true},
+	"\x1b[d": {Code: CodeLeft, Shift: true},
+
+	// CSI <number> ~
+	"\x1b[1~":   {Code: CodeHome},
+	"\x1b[2~":   {Code: CodeInsert},
+	"\x1b[3~":   {Code: CodeDelete},
+	"\x1b[4~":   {Code: CodeEnd},
+	"\x1b[5~":   {Code: CodePageUp},
+	"\x1b[6~":   {Code: CodePageDown},
+	"\x1b[7~":   {Code: CodeHome},
+	"\x1b[8~":   {Code: CodeEnd},
+	"\x1b[200~": {Code: CodePasteStart},
+	"\x1b[201~": {Code: CodePasteEnd},
+}
+
+// DecodeKey reads the next key using read. The escape sequences in
+// KnownSequences are recognised, along with xterm style modifiers such as the
+// 5 in "\x1b[1;5D" for Ctrl+Left. Other CSI ("\x1b[") and SS3 ("\x1bO")
+// sequences are read whole and decoded as CodeUnknown.
+//
+// An error from the first read is returned as it is. If read fails part way
+// through a sequence, such as when the rest of it doesn't arrive in time,
+// what's been read so far is returned as one key and the error is dropped.
+func DecodeKey(read func() (rune, error)) (Key, error) {
+	var seq []rune
+	next := func() (rune, bool) {
+		r, err := read()
+		if err != nil {
+			return 0, false
+		}
+		seq = append(seq, r)
+		return r, true
+	}
+
+	r, err := read()
+	if err != nil {
+		return Key{}, err
+	}
+	seq = append(seq, r)
+
+	if r != CharEsc {
+		return Key{Code: CodeRune, Rune: r, Seq: string(r)}, nil
+	}
+
+	r, ok := next()
+	if !ok {
+		return Key{Code: CodeEscape, Seq: string(seq)}, nil
+	}
+
+	switch r {
+	case CharEscapeEx:
+		key := decodeCSI(next)
+		key.Seq = string(seq)
+		return key, nil
+	case 'O':
+		// some terminals put the modifiers first, as in "\x1bO2A" for
+		// Shift+Up
+		r, ok := next()
+		var m int
+		for cnt := 0; ok && cnt < 2 && r >= '0' && r <= '9'; cnt++ {
+			m = m*10 + int(r-'0')
+			r, ok = next()
+		}
+		if key, known := KnownSequences["\x1bO"+string(r)]; ok && known {
+			key.modify(m)
+			key.Seq = string(seq)
+			return key, nil
+		}
+		return Key{Code: CodeUnknown, Seq: string(seq)}, nil
+	}
+
+	return Key{Code: CodeRune, Rune: r, Meta: true, Seq: string(seq)}, nil
+}
+
+// decodeCSI decodes the rest of a CSI sequence, reading up to its final byte.
+func decodeCSI(next func() (rune, bool)) Key {
+	var params strings.Builder
+	for cnt := 0; cnt < 16; cnt++ {
+		r, ok := next()
+		if !ok {
+			break
+		}
+
+		if r < 0x40 || r > 0x7e {
+			params.WriteRune(r)
+			continue
+		}
+
+		// the first parameter says which key for ~ and the second holds
+		// the modifiers
+		fields := strings.Split(params.String(), ";")
+		name := "\x1b[" + string(r)
+		if r == '~' {
+			n, _ := strconv.Atoi(fields[0])
+			name = "\x1b[" + strconv.Itoa(n) + "~"
+		}
+
+		key, known := KnownSequences[name]
+		if !known {
+			return Key{Code: CodeUnknown}
+		}
+
+		if len(fields) > 1 {
+			if m, err := strconv.Atoi(fields[1]); err == nil {
+				key.modify(m)
+			}
+		}
+		return key
+	}
+
+	return Key{Code: CodeUnknown}
+}
+
+// modify sets the modifiers from an xterm style modifier parameter, which is
+// 1 plus Shift as 1, Meta as 2 and Ctrl as 4.
+func (k *Key) modify(m int) {
+	if m > 1 {
+		k.Shift = (m-1)&1 != 0
+		k.Meta = (m-1)&2 != 0
+		k.Ctrl = (m-1)&4 != 0
+	}
+}
+
+// rawByte is added to a byte that isn't valid UTF-8 to pass it on as a rune.
+// The result is a low surrogate, which never comes from decoding UTF-8.
+const rawByte = 0xdc00
+
+func isRawByte(r rune) bool {
+	return r >= rawByte && r <= rawByte+0xff
+}
+
+// decodeByte turns a byte that wasn't valid UTF-8 into Meta and the byte
+// without its high bit if MetaHighBit is set. Otherwise it's the
+// replacement character like any other invalid input.
+func (i *Instance) decodeByte(k Key) Key {
+	b := k.Rune - rawByte
+	seq := string([]byte{byte(b)})
+	if !i.MetaHighBit || b < 0x80 {
+		return Key{Code: CodeRune, Rune: utf8.RuneError, Seq: seq}
+	}
+	return Key{Code: CodeRune, Rune: b &^ 0x80, Meta: true, Seq: seq}
+}
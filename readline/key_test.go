@@ -0,0 +1,199 @@
+package readline
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// runeReader returns the runes of s one at a time and then err.
+func runeReader(s string, err error) func() (rune, error) {
+	runes := []rune(s)
+	return func() (rune, error) {
+		if len(runes) == 0 {
+			return 0, err
+		}
+		r := runes[0]
+		runes = runes[1:]
+		return r, nil
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	testCases := map[string]Key{
+		"a":         {Code: CodeRune, Rune: 'a'},
+		"世":         {Code: CodeRune, Rune: '世'},
+		"\r":        {Code: CodeRune, Rune: CharEnter},
+		"\x1b[A":    {Code: CodeUp},
+		"\x1b[B":    {Code: CodeDown},
+		"\x1b[C":    {Code: CodeRight},
+		"\x1b[D":    {Code: CodeLeft},
+		"\x1bOA":    {Code: CodeUp},
+		"\x1bOH":    {Code: CodeHome},
+		"\x1b[H":    {Code: CodeHome},
+		"\x1b[F":    {Code: CodeEnd},
+		"\x1b[1~":   {Code: CodeHome},
+		"\x1b[4~":   {Code: CodeEnd},
+		"\x1b[2~":   {Code: CodeInsert},
+		"\x1b[3~":   {Code: CodeDelete},
+		"\x1b[5~":   {Code: CodePageUp},
+		"\x1b[6~":   {Code: CodePageDown},
+		"\x1b[Z":    {Code: CodeShiftTab},
+		"\x1b[200~": {Code: CodePasteStart},
+		"\x1b[201~": {Code: CodePasteEnd},
+		"\x1b[1;5D": {Code: CodeLeft, Ctrl: true},
+		"\x1b[1;2A": {Code: CodeUp, Shift: true},
+		"\x1b[1;3C": {Code: CodeRight, Meta: true},
+		"\x1b[3;8~": {Code: CodeDelete, Shift: true, Meta: true, Ctrl: true},
+		"\x1bb":     {Code: CodeRune, Rune: 'b', Meta: true},
+		"\x1b\x7f":  {Code: CodeRune, Rune: CharBackspace, Meta: true},
+		"\x1b\x1b":  {Code: CodeRune, Rune: CharEsc, Meta: true},
+		"\x1b[99~":  {Code: CodeUnknown},
+		"\x1b[>5q":  {Code: CodeUnknown},
+		"\x1bOx":    {Code: CodeUnknown},
+	}
+
+	for input, expect := range testCases {
+		read := runeReader(input+"x", io.EOF)
+
+		key, err := DecodeKey(read)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+
+		expect.Seq = input
+		if key != expect {
+			t.Errorf("%q: expected %+v, got %+v", input, expect, key)
+		}
+
+		// nothing past the end of the sequence is read
+		if next, _ := DecodeKey(read); !next.IsRune('x') {
+			t.Errorf("%q: expected x to follow, got %+v", input, next)
+		}
+	}
+}
+
+func TestKnownSequences(t *testing.T) {
+	for input, expect := range KnownSequences {
+		read := runeReader(input+"x", io.EOF)
+
+		key, err := DecodeKey(read)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+
+		expect.Seq = input
+		if key != expect {
+			t.Errorf("%q: expected %+v, got %+v", input, expect, key)
+		}
+
+		if next, _ := DecodeKey(read); !next.IsRune('x') {
+			t.Errorf("%q: expected x to follow, got %+v", input, next)
+		}
+	}
+
+	// one that's added is recognised, with modifiers
+	KnownSequences["\x1b[24~"] = Key{Code: CodeInsert}
+	defer delete(KnownSequences, "\x1b[24~")
+
+	key, _ := DecodeKey(runeReader("\x1b[24;5~", io.EOF))
+	if expect := (Key{Code: CodeInsert, Ctrl: true, Seq: "\x1b[24;5~"}); key != expect {
+		t.Fatalf("expected %+v, got %+v", expect, key)
+	}
+}
+
+func TestDecodeShiftArrows(t *testing.T) {
+	testCases := map[string]Key{
+		"\x1b[1;2A": {Code: CodeUp, Shift: true},
+		"\x1b[1;2B": {Code: CodeDown, Shift: true},
+		"\x1b[1;2C": {Code: CodeRight, Shift: true},
+		"\x1b[1;2D": {Code: CodeLeft, Shift: true},
+		"\x1b[1;6C": {Code: CodeRight, Shift: true, Ctrl: true},
+		"\x1b[a":    {Code: CodeUp, Shift: true},
+		"\x1b[b":    {Code: CodeDown, Shift: true},
+		"\x1b[c":    {Code: CodeRight, Shift: true},
+		"\x1b[d":    {Code: CodeLeft, Shift: true},
+		"\x1bO2A":   {Code: CodeUp, Shift: true},
+		"\x1bO2D":   {Code: CodeLeft, Shift: true},
+		"\x1bO5C":   {Code: CodeRight, Ctrl: true},
+		"\x1bO2x":   {Code: CodeUnknown},
+	}
+
+	for input, expect := range testCases {
+		read := runeReader(input+"x", io.EOF)
+
+		key, err := DecodeKey(read)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+
+		expect.Seq = input
+		if key != expect {
+			t.Errorf("%q: expected %+v, got %+v", input, expect, key)
+		}
+
+		if next, _ := DecodeKey(read); !next.IsRune('x') {
+			t.Errorf("%q: expected x to follow, got %+v", input, next)
+		}
+	}
+}
+
+func TestDecodeKeyIncomplete(t *testing.T) {
+	testCases := map[string]KeyCode{
+		"\x1b":                      CodeEscape,
+		"\x1b[":                     CodeUnknown,
+		"\x1b[1;5":                  CodeUnknown,
+		"\x1bO":                     CodeUnknown,
+		"\x1b[12345678901234567890": CodeUnknown,
+	}
+
+	for input, expect := range testCases {
+		stalled := errors.New("stalled")
+		key, err := DecodeKey(runeReader(input, stalled))
+		if err != nil {
+			t.Fatalf("%q: expected the error to be dropped, got %v", input, err)
+		}
+
+		if key.Code != expect {
+			t.Errorf("%q: expected %v, got %+v", input, expect, key)
+		}
+	}
+
+	// an error before anything's been read is passed on
+	if _, err := DecodeKey(runeReader("", io.EOF)); err != io.EOF {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestMetaHighBit(t *testing.T) {
+	type testCase struct {
+		input  string
+		high   bool
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"escape":          {"hello world\x1bbX\r", false, "hello Xworld"},
+		"escape only":     {"hello world\xe2X\r", false, "hello world�X"},
+		"high bit":        {"hello world\xe2X\r", true, "hello Xworld"},
+		"both":            {"hello world\x1bb\xe2X\r", true, "Xhello world"},
+		"utf-8":           {"h\xc3\xa2\r", true, "hâ"},
+		"high bit delete": {"one two\xff\r", true, "one "},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.MetaHighBit = v.high
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package readline
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Action is something a key can be bound to with Keymap. They're named as in
+// GNU readline.
+type Action string
+
+const (
+	ActionBeginningOfLine      Action = "beginning-of-line"    // Ctrl+A
+	ActionBackwardChar         Action = "backward-char"        // Ctrl+B
+	ActionDeleteChar           Action = "delete-char"          // Ctrl+D
+	ActionEndOfLine            Action = "end-of-line"          // Ctrl+E
+	ActionForwardChar          Action = "forward-char"         // Ctrl+F
+	ActionAbort                Action = "abort"                // Ctrl+G
+	ActionBackwardDeleteChar   Action = "backward-delete-char" // Backspace, Ctrl+H
+	ActionComplete             Action = "complete"             // Tab
+	ActionAcceptLine           Action = "accept-line"          // Enter, Ctrl+J
+	ActionKillLine             Action = "kill-line"            // Ctrl+K
+	ActionClearScreen          Action = "clear-screen"         // Ctrl+L
+	ActionNextHistory          Action = "next-history"         // Ctrl+N
+	ActionOperateAndGetNext    Action = "operate-and-get-next" // Ctrl+O
+	ActionPreviousHistory      Action = "previous-history"     // Ctrl+P
+	ActionReverseSearchHistory Action = "reverse-search-history"
+	ActionForwardSearchHistory Action = "forward-search-history"
+	ActionUnixLineDiscard      Action = "unix-line-discard" // Ctrl+U, up to the cursor
+	ActionQuotedInsert         Action = "quoted-insert"     // Ctrl+V
+	ActionUnixWordRubout       Action = "unix-word-rubout"  // Ctrl+W
+	ActionYank                 Action = "yank"              // Ctrl+Y
+	ActionKillWholeLine        Action = "kill-whole-line"
+	// ActionReplaceWord swaps the word under the cursor for the last kill,
+	// which then holds the word
+	ActionReplaceWord Action = "replace-word"
+	// ActionEditLine edits the line in $VISUAL or $EDITOR. Unlike GNU
+	// readline's edit-and-execute-command it isn't submitted afterwards.
+	ActionEditLine Action = "edit-line" // Ctrl+X Ctrl+E
+	// ActionNone makes a key do nothing, which is what Rebind leaves on the
+	// keys it takes an action away from
+	ActionNone Action = "none"
+)
+
+// Binding is a key and the action it's bound to.
+type Binding struct {
+	Key    Key
+	Name   string // the key as it's written, such as "Ctrl+A"
+	Action Action
+}
+
+// defaultKeys are the keys each action is bound to when Keymap doesn't say
+// otherwise. The first is the one the action is done with when it's bound
+// to another key.
+var defaultKeys = map[Action][]rune{
+	ActionBeginningOfLine:      {CharLineStart},
+	ActionBackwardChar:         {CharBackward},
+	ActionDeleteChar:           {CharDelete},
+	ActionEndOfLine:            {CharLineEnd},
+	ActionForwardChar:          {CharForward},
+	ActionAbort:                {CharCtrlG},
+	ActionBackwardDeleteChar:   {CharBackspace, CharCtrlH},
+	ActionComplete:             {CharTab},
+	ActionAcceptLine:           {CharEnter, CharCtrlJ},
+	ActionKillLine:             {CharKill},
+	ActionClearScreen:          {CharCtrlL},
+	ActionNextHistory:          {CharNext},
+	ActionOperateAndGetNext:    {CharCtrlO},
+	ActionPreviousHistory:      {CharPrev},
+	ActionReverseSearchHistory: {CharBckSearch},
+	ActionForwardSearchHistory: {CharFwdSearch},
+	ActionUnixLineDiscard:      {CharCtrlU},
+	ActionQuotedInsert:         {CharCtrlV},
+	ActionUnixWordRubout:       {CharCtrlW},
+	ActionYank:                 {CharCtrlY},
+}
+
+// defaultChords are the actions bound to a prefix followed by another key
+// when Chords doesn't say otherwise.
+var defaultChords = map[rune]map[rune]Action{
+	CharCtrlX: {CharLineEnd: ActionEditLine},
+}
+
+// isPrefix reports whether r starts a chord. A key bound with Keymap only
+// does when there's a ChordTimeout, after which it does what it's bound to.
+func (i *Instance) isPrefix(r rune) bool {
+	if _, ok := i.Keymap[r]; ok && i.ChordTimeout <= 0 {
+		return false
+	}
+	return len(i.Chords[r]) > 0 || len(defaultChords[r]) > 0
+}
+
+// chordAction returns the action bound to prefix followed by r, if any.
+func (i *Instance) chordAction(prefix, r rune) (Action, bool) {
+	if a, ok := i.Chords[prefix][r]; ok {
+		return a, true
+	}
+	a, ok := defaultChords[prefix][r]
+	return a, ok
+}
+
+// do carries out a, returning false if it isn't an action it knows. The word
+// actions act on n words.
+func (i *Instance) do(buf *Buffer, a Action, n int) bool {
+	switch a {
+	case ActionKillLine:
+		i.kills.kill(buf.cut(buf.Pos, buf.Size()), false)
+	case ActionUnixLineDiscard:
+		i.kills.kill(buf.cut(0, buf.Pos), true)
+	case ActionKillWholeLine:
+		line := []rune(buf.String())
+		buf.Clear()
+		i.kills.kill(line, false)
+	case ActionUnixWordRubout:
+		i.kills.kill(buf.cut(buf.prevWord(n), buf.Pos), true)
+	case ActionYank:
+		buf.AddString(string(i.kills.yank()))
+	case ActionReplaceWord:
+		text := string(i.kills.yank())
+		// the word is a kill of its own even after another kill
+		i.kills.appending = false
+		i.kills.kill(buf.ReplaceWord(text), false)
+	case ActionNone:
+	default:
+		return false
+	}
+	return true
+}
+
+// boundTo returns what r is bound to, by Keymap or by default, which is ""
+// if it isn't bound to anything.
+func (i *Instance) boundTo(r rune) Action {
+	if a, ok := i.Keymap[r]; ok {
+		return a
+	}
+	for a, keys := range defaultKeys {
+		for _, k := range keys {
+			if k == r {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// keyName returns how r is written for a person to read, such as "Ctrl+A".
+func keyName(r rune) string {
+	switch {
+	case r == CharTab:
+		return "Tab"
+	case r == CharEnter:
+		return "Enter"
+	case r == CharEsc:
+		return "Esc"
+	case r == CharBackspace:
+		return "Backspace"
+	case r < CharSpace:
+		return "Ctrl+" + string(r+'@')
+	}
+	return string(r)
+}
+
+// known reports whether a is an action Rebind can bind, which is any that
+// has a default key or that do carries out.
+func known(a Action) bool {
+	if _, ok := defaultKeys[a]; ok {
+		return true
+	}
+	return a == ActionKillWholeLine || a == ActionReplaceWord || a == ActionEditLine || a == ActionNone
+}
+
+// bindings returns what each key that's bound to something is bound to.
+func (i *Instance) bindings() map[rune]Action {
+	bound := make(map[rune]Action)
+	for a, keys := range defaultKeys {
+		for _, r := range keys {
+			bound[r] = a
+		}
+	}
+
+	for r, a := range i.Keymap {
+		if a == ActionNone {
+			delete(bound, r)
+		} else {
+			bound[r] = a
+		}
+	}
+	return bound
+}
+
+// Bindings returns the keys Keymap can bind, along with the actions they're
+// bound to, including the defaults. They're ordered by key. Meta keys and
+// the arrows aren't included since they can't be bound, nor are Chords, and
+// InterruptKey, SuspendKey and EOFKey on an empty line come before any
+// binding of their keys.
+func (i *Instance) Bindings() []Binding {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	bound := i.bindings()
+	keys := make([]rune, 0, len(bound))
+	for r := range bound {
+		keys = append(keys, r)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+
+	bindings := make([]Binding, len(keys))
+	for cnt, r := range keys {
+		bindings[cnt] = Binding{Key: Key{Code: CodeRune, Rune: r}, Name: keyName(r), Action: bound[r]}
+	}
+	return bindings
+}
+
+// Rebind binds the action called name to keys in place of the keys it's
+// bound to now, which are left doing nothing. Only keys without Meta can be
+// bound, as with Keymap. Like Configure it's safe to call from another
+// goroutine.
+func (i *Instance) Rebind(name string, keys ...Key) error {
+	a := Action(name)
+	if !known(a) {
+		return fmt.Errorf("unknown action %q", name)
+	}
+	for _, k := range keys {
+		if k.Code != CodeRune || k.Meta {
+			return fmt.Errorf("can't bind %q, only keys without Meta can be bound", k.Seq)
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.Keymap == nil {
+		i.Keymap = make(map[rune]Action)
+	}
+	for r, bound := range i.bindings() {
+		if bound == a {
+			i.Keymap[r] = ActionNone
+		}
+	}
+	for _, k := range keys {
+		i.Keymap[k.Rune] = a
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package readline
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeymap(t *testing.T) {
+	type testCase struct {
+		keymap map[rune]Action
+		input  string
+		expect []string
+	}
+
+	testCases := map[string]*testCase{
+		"default ctrl u": {nil, "abc def\x02\x02\x15\r\x19\r", []string{"ef", "abc d"}},
+		"kill whole line": {
+			map[rune]Action{CharCtrlU: ActionKillWholeLine},
+			"abc def\x02\x02\x15\r\x19\r",
+			[]string{"", "abc def"},
+		},
+		"yanked back": {
+			map[rune]Action{CharCtrlU: ActionKillWholeLine},
+			"abc def\x02\x02\x15\x19\r",
+			[]string{"abc def"},
+		},
+		"other key": {
+			map[rune]Action{CharCtrlO: ActionKillWholeLine},
+			"abc\x0f\x19\x19\r",
+			[]string{"abcabc"},
+		},
+		"replace word": {
+			map[rune]Action{CharCtrlO: ActionReplaceWord},
+			"TWO\x15one two three\x02\x02\x02\x02\x02\x02\x02\x0f\r",
+			[]string{"one TWO three"},
+		},
+		"replaced word yanked": {
+			map[rune]Action{CharCtrlO: ActionReplaceWord},
+			"TWO\x15one two three\x02\x02\x02\x02\x02\x02\x02\x0f\x05 \x19\r",
+			[]string{"one TWO three two"},
+		},
+		"replace word after kill": {
+			map[rune]Action{CharCtrlO: ActionReplaceWord},
+			"one two three\x02\x02\x02\x02\x02\x02\x0b\x0f\x19\r",
+			[]string{"one  threetwo"},
+		},
+		"unknown action": {
+			map[rune]Action{CharCtrlU: "self-destruct"},
+			"abc def\x02\x02\x15\r",
+			[]string{"ef"},
+		},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.Keymap = v.keymap
+
+			for _, expect := range v.expect {
+				line, err := i.Readline()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if line != expect {
+					t.Fatalf("expected %q, got %q", expect, line)
+				}
+			}
+		})
+	}
+}
+
+func TestBindings(t *testing.T) {
+	i, _ := newTestInstance("")
+
+	bindings := i.Bindings()
+	if len(bindings) != 22 {
+		t.Fatalf("expected 22 bindings, got %d", len(bindings))
+	}
+
+	testCases := map[string]Action{
+		"Ctrl+A":    ActionBeginningOfLine,
+		"Ctrl+B":    ActionBackwardChar,
+		"Ctrl+G":    ActionAbort,
+		"Ctrl+H":    ActionBackwardDeleteChar,
+		"Backspace": ActionBackwardDeleteChar,
+		"Tab":       ActionComplete,
+		"Enter":     ActionAcceptLine,
+		"Ctrl+K":    ActionKillLine,
+		"Ctrl+R":    ActionReverseSearchHistory,
+	}
+
+	for _, b := range bindings {
+		if expect, ok := testCases[b.Name]; ok && b.Action != expect {
+			t.Fatalf("expected %s bound to %q, got %q", b.Name, expect, b.Action)
+		}
+		delete(testCases, b.Name)
+	}
+	if len(testCases) > 0 {
+		t.Fatalf("expected bindings for %v", testCases)
+	}
+
+	// ordered by key
+	if bindings[0].Name != "Ctrl+A" || bindings[len(bindings)-1].Name != "Backspace" {
+		t.Fatalf("expected Ctrl+A first and Backspace last, got %s and %s", bindings[0].Name, bindings[len(bindings)-1].Name)
+	}
+
+	i.Keymap = map[rune]Action{CharCtrlU: ActionKillWholeLine, CharCtrlY: ActionNone}
+	var names []string
+	for _, b := range i.Bindings() {
+		if b.Action == ActionKillWholeLine || b.Name == "Ctrl+Y" {
+			names = append(names, b.Name)
+		}
+	}
+	if expect := []string{"Ctrl+U"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expected %q, got %q", expect, names)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	ctrl := func(r rune) Key {
+		return Key{Code: CodeRune, Rune: r - '@'}
+	}
+
+	type testCase struct {
+		action string
+		keys   []Key
+		input  string
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"backward char": {"backward-char", []Key{ctrl('G')}, "abc\x07X\x02Y\r", "abXYc"},
+		"kill line":     {"kill-line", []Key{ctrl('G')}, "abc\x01\x02\x0bX\x07\r", "X"},
+		"accept line":   {"accept-line", []Key{ctrl('G'), ctrl('J')}, "ab\rc\x07", "abc"},
+		"two keys":      {"beginning-of-line", []Key{ctrl('G'), ctrl('Q')}, "ab\x07X\x05\x11Y\x01\r", "YXab"},
+		"kill whole":    {"kill-whole-line", []Key{ctrl('G')}, "ab\x07c\r", "c"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			if err := i.Rebind(v.action, v.keys...); err != nil {
+				t.Fatal(err)
+			}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			var keys []Key
+			for _, b := range i.Bindings() {
+				if b.Action == Action(v.action) {
+					keys = append(keys, b.Key)
+				}
+			}
+			if !reflect.DeepEqual(keys, v.keys) {
+				t.Fatalf("expected %v bound, got %v", v.keys, keys)
+			}
+		})
+	}
+}
+
+func TestRebindEnterEndOfInput(t *testing.T) {
+	type testCase struct {
+		action string
+		key    Key
+	}
+
+	testCases := map[string]*testCase{
+		"accept line moved": {"accept-line", Key{Code: CodeRune, Rune: CharCtrlJ}},
+		"enter rebound":     {"backward-char", Key{Code: CodeRune, Rune: CharEnter}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance("abc")
+			if err := i.Rebind(v.action, v.key); err != nil {
+				t.Fatal(err)
+			}
+
+			// the line left when the input ends is still submitted
+			done := make(chan string, 1)
+			go func() {
+				line, _ := i.Readline()
+				done <- line
+			}()
+
+			select {
+			case line := <-done:
+				if line != "abc" {
+					t.Fatalf("expected %q, got %q", "abc", line)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected Readline to return at the end of the input")
+			}
+		})
+	}
+}
+
+func TestRebindErrors(t *testing.T) {
+	i, _ := newTestInstance("")
+
+	if err := i.Rebind("self-destruct", Key{Code: CodeRune, Rune: CharCtrlO}); err == nil {
+		t.Fatalf("expected an error for an unknown action")
+	}
+
+	if err := i.Rebind("kill-line", Key{Code: CodeRune, Rune: 'k', Meta: true}); err == nil {
+		t.Fatalf("expected an error for a Meta key")
+	}
+
+	if i.Keymap != nil {
+		t.Fatalf("expected nothing to be bound, got %v", i.Keymap)
+	}
+}
+
+func TestChords(t *testing.T) {
+	type testCase struct {
+		chords map[rune]map[rune]Action
+		input  string
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"ctrl x ctrl e": {
+			map[rune]map[rune]Action{CharCtrlX: {CharLineEnd: ActionKillWholeLine}},
+			"abc\x18\x05\x19\x19\r",
+			"abcabc",
+		},
+		"new prefix": {
+			map[rune]map[rune]Action{CharKill: {'k': ActionKillWholeLine}},
+			"abc\x02\x0bk\r",
+			"",
+		},
+		"unbound follow-up": {
+			map[rune]map[rune]Action{CharKill: {'k': ActionKillWholeLine}},
+			"abc\x02\x0b\x02x\r",
+			"axbc",
+		},
+		"unbound after ctrl x": {nil, "ab\x18\x02x\r", "axb"},
+		"unbound":              {map[rune]map[rune]Action{CharCtrlX: {CharLineEnd: ActionNone}}, "ab\x18\x05x\r", "abx"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.Chords = v.chords
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
+
+func TestChordKeymap(t *testing.T) {
+	testCases := map[string]string{
+		// Ctrl+X is bound so it isn't a prefix and Ctrl+E moves to the end
+		"ab\x18\x05x\r": "x",
+		"ab\x02\x18c\r": "c",
+	}
+
+	for input, expect := range testCases {
+		t.Run(input, func(t *testing.T) {
+			i, _ := newTestInstance(input)
+			i.Keymap = map[rune]Action{CharCtrlX: ActionKillWholeLine}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != expect {
+				t.Fatalf("expected %q, got %q", expect, line)
+			}
+		})
+	}
+
+	// Rebind does the same
+	i, _ := newTestInstance("ab\x18\x05x\r")
+	if err := i.Rebind("kill-whole-line", Key{Code: CodeRune, Rune: CharCtrlX}); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := i.Readline(); line != "x" {
+		t.Fatalf("expected %q, got %q", "x", line)
+	}
+}
+
+func TestChordTimeout(t *testing.T) {
+	type testCase struct {
+		input  string
+		follow string // typed once ChordTimeout has passed
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"kill line on its own":     {"abc\x02\x02\x0b", "k\r", "ak"},
+		"ctrl x does nothing":      {"abc\x02\x02\x18", "\x05k\r", "abck"},
+		"chord before the timeout": {"abc\x02\x02\x0bk", "\r", ""},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			r, w := io.Pipe()
+			defer w.Close()
+
+			i, _ := newTestInstance("")
+			i.Terminal = newTerminal(r, io.Discard)
+			// Ctrl+K Ctrl+K isn't what Ctrl+K does on its own
+			i.Chords = map[rune]map[rune]Action{CharKill: {'k': ActionKillWholeLine, CharKill: ActionKillWholeLine}}
+			i.ChordTimeout = 10 * time.Millisecond
+
+			lines := make(chan string)
+			go func() {
+				line, _ := i.Readline()
+				lines <- line
+			}()
+
+			w.Write([]byte(v.input))
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte(v.follow))
+
+			if line := <-lines; line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package readline
+
+// killRingSize is how many kills are kept
+const killRingSize = 10
+
+// killRing holds text removed by the kill commands so it can be yanked back.
+//
+// Kills straight after one another build up a single entry so it can be
+// yanked back as it was. Backwards kills, like Ctrl+W, go in front of what's
+// been killed so far and forwards kills, like Meta-D, go after it.
+type killRing struct {
+	entries [][]rune
+
+	killed    bool // the last key was a kill
+	appending bool // the key before this one was a kill
+}
+
+// key is called for every key so kills can tell if they follow a kill.
+func (k *killRing) key() {
+	k.appending = k.killed
+	k.killed = false
+}
+
+func (k *killRing) kill(text []rune, backward bool) {
+	if len(text) == 0 {
+		return
+	}
+	k.killed = true
+
+	if k.appending && len(k.entries) > 0 {
+		last := k.entries[len(k.entries)-1]
+		if backward {
+			last = append(append([]rune{}, text...), last...)
+		} else {
+			last = append(last, text...)
+		}
+		k.entries[len(k.entries)-1] = last
+		return
+	}
+
+	k.entries = append(k.entries, append([]rune{}, text...))
+	if len(k.entries) > killRingSize {
+		k.entries = k.entries[1:]
+	}
+}
+
+// yank returns the most recent kill.
+func (k *killRing) yank() []rune {
+	if len(k.entries) == 0 {
+		return nil
+	}
+	return k.entries[len(k.entries)-1]
+}
@@ -0,0 +1,50 @@
+package readline
+
+import (
+	"testing"
+)
+
+func TestKillRing(t *testing.T) {
+	testCases := map[string]string{
+		// three words killed backwards come back in their original order
+		"one two three\x17\x17\x17\x19\r":     "one two three",
+		"one two three\x1b\x7f\x1b\x7f\x19\r": "one two three",
+		"one two three\x17\x1b\x7f\x17\x19\r": "one two three",
+		// forwards kills go after one another
+		"one two three\x01\x1bd\x1bd\x19\r": "one two three",
+		"one two three\x01\x1bd\x1bd\r":     " three",
+		// moving in between starts a new kill
+		"one two three\x17\x02\x17\x05\x19\r": "one  two",
+		"abc def\x02\x02\x0b\x01\x19\r":       "efabc d",
+		"abc def\x02\x02\x15\x05\x19\r":       "efabc d",
+		"nothing to yank\x19\r":               "nothing to yank",
+	}
+
+	for input, expect := range testCases {
+		i, _ := newTestInstance(input)
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Errorf("%q: expected %q, got %q", input, expect, line)
+		}
+	}
+}
+
+func TestKillRingBetweenLines(t *testing.T) {
+	i, _ := newTestInstance("first word\x17\r\x19\r")
+
+	for _, expect := range []string{"first ", "word"} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package readline
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// LineResult is a line sent by Lines, along with the error Readline returned
+// with it.
+type LineResult struct {
+	Line string
+	Err  error
+}
+
+// Lines calls Readline over and over in a goroutine of its own and sends
+// what each call returns, for a terminal and piped input alike. ErrInterrupt
+// is sent and reading carries on, but any other error is the last thing sent.
+// The channel is closed once the input ends or ctx is done, and the terminal
+// is left as it was before, as it is after Readline. A line that's been
+// started when ctx is done is dropped. Readline mustn't be called until the
+// channel has been closed.
+func (i *Instance) Lines(ctx context.Context) <-chan LineResult {
+	lines := make(chan LineResult)
+
+	go func() {
+		defer close(lines)
+
+		i.cancel = ctx.Done()
+		defer func() { i.cancel, i.Terminal.cancel = nil, nil }()
+
+		for {
+			line, err := i.Readline()
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return
+			}
+
+			select {
+			case lines <- LineResult{Line: line, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil && !errors.Is(err, ErrInterrupt) {
+				return
+			}
+		}
+	}()
+
+	return lines
+}
@@ -0,0 +1,134 @@
+package readline
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLines(t *testing.T) {
+	type testCase struct {
+		input  string
+		piped  bool
+		expect []LineResult
+	}
+
+	testCases := map[string]*testCase{
+		"piped":       {"one\ntwo\nthree\n", true, []LineResult{{Line: "one"}, {Line: "two"}, {Line: "three"}}},
+		"no newline":  {"one\ntwo", true, []LineResult{{Line: "one"}, {Line: "two"}}},
+		"terminal":    {"one\rtwo\r", false, []LineResult{{Line: "one"}, {Line: "two"}}},
+		"interrupted": {"one\rtw\x03three\r", false, []LineResult{{Line: "one"}, {Err: ErrInterrupt}, {Line: "three"}}},
+		"empty":       {"", true, nil},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.Terminal.piped = v.piped
+
+			var results []LineResult
+			for result := range i.Lines(context.Background()) {
+				results = append(results, result)
+			}
+
+			if !reflect.DeepEqual(results, v.expect) {
+				t.Fatalf("expected %v, got %v", v.expect, results)
+			}
+		})
+	}
+}
+
+func TestLinesCancel(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := i.Lines(ctx)
+
+	w.Write([]byte("one\r"))
+	if result := <-lines; result.Line != "one" || result.Err != nil {
+		t.Fatalf("expected %q, got %v", "one", result)
+	}
+
+	cancel()
+	if result, ok := <-lines; ok {
+		t.Fatalf("expected the channel to be closed, got %v", result)
+	}
+
+	// the terminal can still be read from
+	go w.Write([]byte("two\r"))
+	if line, err := i.Readline(); err != nil || line != "two" {
+		t.Fatalf("expected %q, got %q and %v", "two", line, err)
+	}
+}
+
+func TestLinesCancelTyping(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	var log bytes.Buffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.SessionLog = &log
+	i.OnSubmit = func(line string) string {
+		t.Fatalf("didn't expect %q to be submitted", line)
+		return line
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := i.Lines(ctx)
+
+	w.Write([]byte("unfinished"))
+	for !strings.Contains(out.String(), "unfinished") {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if result, ok := <-lines; ok {
+		t.Fatalf("expected the channel to be closed, got %v", result)
+	}
+
+	if i.History.Size() != 0 {
+		t.Fatalf("expected the history to be empty, got %d entries", i.History.Size())
+	}
+
+	if !strings.Contains(log.String(), `cancel "unfinished"`) {
+		t.Fatalf("expected the line to be logged as canceled, got %q", log.String())
+	}
+}
+
+func TestLinesCancelPiped(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, io.Discard)
+	i.Terminal.piped = true
+	var log bytes.Buffer
+	i.SessionLog = &log
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := i.Lines(ctx)
+
+	w.Write([]byte("one\ntw"))
+	if result := <-lines; result.Line != "one" {
+		t.Fatalf("expected %q, got %v", "one", result)
+	}
+
+	cancel()
+	if result, ok := <-lines; ok {
+		t.Fatalf("expected the channel to be closed, got %v", result)
+	}
+
+	if strings.Contains(log.String(), `submit "tw"`) {
+		t.Fatalf("expected the unfinished line to be dropped, got %q", log.String())
+	}
+}
@@ -0,0 +1,75 @@
+package readline
+
+// Mask hides the runes from start up to end behind MaskRune, or '*', when
+// the line is drawn. String still returns the real text. Anything typed
+// inside the range or at its end becomes part of it, and an end of -1 masks
+// everything from start onwards.
+func (b *Buffer) Mask(start, end int) {
+	b.masked = true
+	b.maskStart, b.maskEnd = start, end
+	b.draw()
+}
+
+// Unmask shows the whole line again.
+func (b *Buffer) Unmask() {
+	if b.masked {
+		b.masked = false
+		b.draw()
+	}
+}
+
+func (b *Buffer) isMasked(n int) bool {
+	return b.maskAll || b.masked && n >= b.maskStart && (b.maskEnd < 0 || n < b.maskEnd)
+}
+
+// shown returns the rune drawn for the rune at n.
+func (b *Buffer) shown(n int) rune {
+	r := b.runeAt(n)
+	if r == '\n' || !b.isMasked(n) {
+		return r
+	}
+	if b.MaskRune != 0 {
+		return b.MaskRune
+	}
+	return '*'
+}
+
+// inserted moves the mask along after cnt runes are inserted at pos.
+func (b *Buffer) inserted(pos, cnt int) {
+	if !b.masked {
+		return
+	}
+
+	switch {
+	case pos < b.maskStart, pos == b.maskStart && b.maskEnd > b.maskStart:
+		b.maskStart += cnt
+		if b.maskEnd >= 0 {
+			b.maskEnd += cnt
+		}
+	case b.maskEnd >= 0 && pos <= b.maskEnd:
+		b.maskEnd += cnt
+	}
+}
+
+// removed shrinks the mask after the runes from start up to end are removed.
+func (b *Buffer) removed(start, end int) {
+	if !b.masked {
+		return
+	}
+
+	adjust := func(n int) int {
+		switch {
+		case n <= start:
+			return n
+		case n <= end:
+			return start
+		default:
+			return n - (end - start)
+		}
+	}
+
+	b.maskStart = adjust(b.maskStart)
+	if b.maskEnd >= 0 {
+		b.maskEnd = adjust(b.maskEnd)
+	}
+}
@@ -0,0 +1,154 @@
+package readline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func shownString(b *Buffer) string {
+	var sb strings.Builder
+	for cnt := 0; cnt < b.Size(); cnt++ {
+		sb.WriteRune(b.shown(cnt))
+	}
+	return sb.String()
+}
+
+func TestMaskTail(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.out = &out
+
+	b.AddString("Bearer ")
+	b.Mask(b.Size(), -1)
+	b.AddString("secret")
+
+	check := func(value, shown string) {
+		t.Helper()
+		if b.String() != value {
+			t.Fatalf("expected %q, got %q", value, b.String())
+		}
+		if got := shownString(b); got != shown {
+			t.Fatalf("expected %q to be shown, got %q", shown, got)
+		}
+		if strings.Contains(out.String(), "sec") {
+			t.Fatalf("expected the secret not to be drawn, got %q", out.String())
+		}
+	}
+
+	check("Bearer secret", "Bearer ******")
+
+	b.MoveLeft()
+	b.MoveLeft()
+	b.Add('X')
+	check("Bearer secrXet", "Bearer *******")
+
+	b.MoveToStart()
+	b.Delete()
+	check("earer secrXet", "earer *******")
+
+	b.Unmask()
+	if got := shownString(b); got != b.String() {
+		t.Fatalf("expected %q to be shown, got %q", b.String(), got)
+	}
+}
+
+func TestMaskRange(t *testing.T) {
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+	b.SetOutput(&bytes.Buffer{})
+	b.MaskRune = '#'
+
+	b.AddString("key=abc;")
+	b.Mask(4, 7)
+
+	type step struct {
+		edit  func()
+		value string
+		shown string
+	}
+
+	steps := []step{
+		{func() {}, "key=abc;", "key=###;"},
+		// typing at the end of the range extends it
+		{func() { b.Pos = 7; b.Add('d') }, "key=abcd;", "key=####;"},
+		// typing at the start doesn't
+		{func() { b.Pos = 4; b.Add(' ') }, "key= abcd;", "key= ####;"},
+		// after the range is left alone
+		{func() { b.MoveToEnd(); b.AddString("x") }, "key= abcd;x", "key= ####;x"},
+		// removing across the edge shrinks it
+		{func() { b.Pos = 7; b.DeleteBefore() }, "cd;x", "##;x"},
+		{func() { b.Replace([]rune("fresh")) }, "fresh", "fresh"},
+	}
+
+	for _, s := range steps {
+		s.edit()
+		if b.String() != s.value {
+			t.Fatalf("expected %q, got %q", s.value, b.String())
+		}
+		if got := shownString(b); got != s.shown {
+			t.Fatalf("expected %q to be shown, got %q", s.shown, got)
+		}
+	}
+}
+
+func TestInstanceMask(t *testing.T) {
+	type testCase struct {
+		input  string
+		expect string
+		shown  string
+	}
+
+	testCases := map[string]*testCase{
+		"typed":    {"secret\r", "secret", ">>> ******"},
+		"edited":   {"secrt\x1b[De\r", "secret", ">>> *****"},
+		"recalled": {"\x1b[A\r", "ls -l", ">>> *****"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(v.input)
+			i.History = newTestHistory("ls -l")
+			i.Mask = '*'
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			if !strings.Contains(out.String(), v.shown) || strings.Contains(out.String(), v.expect) {
+				t.Fatalf("expected %q to be shown, got %q", v.shown, out.String())
+			}
+
+			// the history only has what was there before
+			if i.History.Size() != 1 {
+				t.Fatalf("expected the line to be kept out of the history, got %d entries", i.History.Size())
+			}
+		})
+	}
+}
+
+func TestInstanceMaskSessionLog(t *testing.T) {
+	i, _ := newTestInstance("ab\x1b[D\r")
+	var log bytes.Buffer
+	i.SessionLog = &log
+	i.SessionLogKeys = true
+	i.Mask = '*'
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{` key "*"`, ` key "\x1b[D"`, ` key "\r"`, ` submit "**"`} {
+		if !strings.Contains(log.String(), expect) {
+			t.Fatalf("expected %q in %q", expect, log.String())
+		}
+	}
+
+	if strings.Contains(log.String(), `"a"`) || strings.Contains(log.String(), "ab") {
+		t.Fatalf("expected the line to be masked, got %q", log.String())
+	}
+}
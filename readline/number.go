@@ -0,0 +1,79 @@
+package readline
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AdjustNumber adds delta to the number under the cursor, or the next one
+// after it, and leaves the cursor on its last digit, like Ctrl+A and Ctrl+X
+// in vi. A minus sign straight before the digits makes the number negative,
+// and numbers with leading zeros keep their width.
+func (b *Buffer) AdjustNumber(delta int) {
+	isDigit := func(n int) bool {
+		r := b.runeAt(n)
+		return r >= '0' && r <= '9'
+	}
+
+	start := b.Pos
+	for start < b.Size() && !isDigit(start) {
+		start += 1
+	}
+	if start == b.Size() {
+		return
+	}
+	for start > 0 && isDigit(start-1) {
+		start -= 1
+	}
+
+	end := start
+	for end < b.Size() && isDigit(end) {
+		end += 1
+	}
+
+	digits := b.StringNM(start, end)
+	negative := start > 0 && b.runeAt(start-1) == '-'
+	if negative {
+		start -= 1
+	}
+
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		// too long to be adjusted
+		return
+	}
+	if negative {
+		n = -n
+	}
+	n += int64(delta)
+
+	text := strconv.FormatInt(n, 10)
+	if len(digits) > 1 && digits[0] == '0' {
+		sign, abs := "", text
+		if n < 0 {
+			sign, abs = "-", text[1:]
+		}
+		if len(abs) < len(digits) {
+			abs = strings.Repeat("0", len(digits)-len(abs)) + abs
+		}
+		text = sign + abs
+	}
+
+	if !b.fits(end-start, len(text)) {
+		return
+	}
+
+	b.remove(start, end)
+	values := make([]interface{}, 0, len(text))
+	for _, r := range text {
+		values = append(values, r)
+	}
+	if start == b.Size() {
+		b.Buf.Add(values...)
+	} else {
+		b.Buf.Insert(start, values...)
+	}
+	b.inserted(start, len(values))
+	b.Pos = start + len(values) - 1
+	b.draw()
+}
@@ -0,0 +1,50 @@
+package readline
+
+import (
+	"io"
+	"testing"
+)
+
+func TestAdjustNumber(t *testing.T) {
+	type testCase struct {
+		text   string
+		pos    int
+		delta  int
+		expect string
+		cursor int
+	}
+
+	testCases := map[string]*testCase{
+		"carry":          {text: "9", delta: 1, expect: "10", cursor: 1},
+		"negative":       {text: "-1", delta: 1, expect: "0", cursor: 0},
+		"below zero":     {text: "0", delta: -1, expect: "-1", cursor: 1},
+		"after cursor":   {text: "port 8080", delta: 1, expect: "port 8081", cursor: 8},
+		"inside number":  {text: "x 129 y", pos: 3, delta: -10, expect: "x 119 y", cursor: 4},
+		"leading zeros":  {text: "007", delta: 1, expect: "008", cursor: 2},
+		"zeros widen":    {text: "099", delta: 1, expect: "100", cursor: 2},
+		"negative zeros": {text: "-005", delta: -1, expect: "-006", cursor: 3},
+		"first only":     {text: "1 2", delta: 1, expect: "2 2", cursor: 0},
+		"no number":      {text: "hello", pos: 2, delta: 1, expect: "hello", cursor: 2},
+		"before cursor":  {text: "12 ab", pos: 3, delta: 1, expect: "12 ab", cursor: 3},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+			b.out = io.Discard
+			b.AddString(v.text)
+			b.MoveToStart()
+			for b.Pos < v.pos {
+				b.MoveRight()
+			}
+
+			b.AdjustNumber(v.delta)
+			if got := b.String(); got != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, got)
+			}
+			if b.Pos != v.cursor {
+				t.Fatalf("expected cursor at %d, got %d", v.cursor, b.Pos)
+			}
+		})
+	}
+}
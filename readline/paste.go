@@ -0,0 +1,74 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PasteOverflow says what happens to a bracketed paste that would make the
+// line longer than MaxLength.
+type PasteOverflow int
+
+const (
+	// PasteTruncate keeps as much of the paste as fits and drops the rest.
+	PasteTruncate PasteOverflow = iota
+	// PasteReject drops all of the paste from the line and rings the bell.
+	PasteReject
+	// PasteSubmit keeps as much of the paste as fits and submits the line.
+	PasteSubmit
+)
+
+// paste adds text from a bracketed paste to buf and reports whether the line
+// is to be submitted because the paste went past MaxLength. before and pos
+// are the line and cursor from before the paste started. Once a paste has
+// overflowed the rest of it is dropped.
+func (i *Instance) paste(buf *Buffer, text, before []rune, pos int) bool {
+	room := i.MaxLength - buf.Size()
+	if i.MaxLength <= 0 || len(text) <= room {
+		buf.AddString(string(text))
+		return false
+	}
+
+	i.pasteOverflowed = true
+	if i.PasteOverflow == PasteReject {
+		buf.setLine(before)
+		buf.Pos = pos
+		buf.draw()
+		fmt.Fprint(buf.out, string(rune(CharBell)))
+		return false
+	}
+
+	buf.AddString(string(text[:max(room, 0)]))
+	return i.PasteOverflow == PasteSubmit
+}
+
+// endPaste forgets a bracketed paste that's in progress, for when Readline
+// returns before the end of it arrives.
+func (i *Instance) endPaste() {
+	i.pasting, i.pasteStored, i.pasteOverflowed = false, false, false
+	i.sunk = 0
+}
+
+// PasteSinkMarker is put in the line in place of a bracketed paste that's
+// been written to PasteSink, with how many bytes of it there were. Pastes
+// are written one after another, so the sizes of the markers in a line say
+// which part of what's been written each of them is.
+const PasteSinkMarker = "[pasted %d bytes]"
+
+// sink writes what key is, as part of a paste, to PasteSink. Pasted lines
+// end with \r as if Enter had been typed, so they're written with \n.
+func (i *Instance) sink(key Key) error {
+	text := key.Seq
+	if key.Code == CodeRune {
+		text = string(append([]rune{key.Rune}, i.Terminal.queuedText()...))
+	}
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	n, err := io.WriteString(i.PasteSink, text)
+	i.sunk += n
+	if err != nil {
+		return fmt.Errorf("writing the paste: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package readline
+
+import (
+	"strings"
+)
+
+// readPiped reads a line from input that isn't a terminal. Nothing is drawn
+// and no keys are interpreted, so tabs and escapes in the line are kept as
+// they are. Only the newline, and a carriage return before it, are removed,
+// unless PreserveTrailingNewline is set.
+func (i *Instance) readPiped() (string, error) {
+	var sb strings.Builder
+	for {
+		r, err := i.Terminal.Read()
+		if err != nil {
+			// the last line doesn't need to end with a newline, but one
+			// that's cut short by Lines is dropped
+			if sb.Len() > 0 && err != errCanceled {
+				return sb.String(), nil
+			}
+			return "", err
+		}
+
+		if r == '\n' {
+			if i.PreserveTrailingNewline {
+				return sb.String() + "\n", nil
+			}
+			return strings.TrimSuffix(sb.String(), "\r"), nil
+		}
+		sb.WriteRune(r)
+	}
+}
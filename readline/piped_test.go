@@ -0,0 +1,87 @@
+package readline
+
+import (
+	"io"
+	"testing"
+)
+
+func TestReadPiped(t *testing.T) {
+	testCases := map[string][]string{
+		"tab":        {"a\tb\n", "a\tb"},
+		"escape":     {"up\x1b[A\n", "up\x1b[A"},
+		"control":    {"\x03\x04\x7f\n", "\x03\x04\x7f"},
+		"crlf":       {"dos\r\n", "dos"},
+		"empty":      {"\n\n", "", ""},
+		"no newline": {"one\ntwo", "one", "two"},
+		"immediate":  {""},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(v[0])
+			i.Terminal.piped = true
+			i.Completer = func(line string, pos int) []string {
+				t.Fatal("didn't expect completion")
+				return nil
+			}
+
+			for _, expect := range v[1:] {
+				line, err := i.Readline()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if line != expect {
+					t.Fatalf("expected %q, got %q", expect, line)
+				}
+			}
+
+			if _, err := i.Readline(); err != io.EOF {
+				t.Fatalf("expected %v, got %v", io.EOF, err)
+			}
+
+			if out.Len() != 0 {
+				t.Fatalf("expected nothing to be drawn, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestReadPipedPreserveNewline(t *testing.T) {
+	i, _ := newTestInstance("one\ndos\r\n\nlast")
+	i.Terminal.piped = true
+	i.PreserveTrailingNewline = true
+
+	for _, expect := range []string{"one\n", "dos\r\n", "\n", "last"} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+}
+
+func TestReadPipedHistory(t *testing.T) {
+	// a piped script's lines, comments or not, are returned but not stored
+	i, _ := newTestInstance("# setup\nls\n")
+	i.Terminal.piped = true
+	i.History.CommentPrefix = "#"
+
+	for _, expect := range []string{"# setup", "ls"} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+
+	if i.History.Size() != 0 {
+		t.Fatalf("expected nothing in the history, got %d entries", i.History.Size())
+	}
+}
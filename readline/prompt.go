@@ -0,0 +1,91 @@
+package readline
+
+import (
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+type PromptAlign int
+
+const (
+	PromptAlignNone PromptAlign = iota
+	// PromptAlignLeft pads the shorter prompt with spaces after it so the
+	// input lines up on every row
+	PromptAlignLeft
+	// PromptAlignRight pads the shorter prompt with spaces before it
+	PromptAlignRight
+)
+
+// first returns the prompt shown in front of the first row.
+func (p *Prompt) first() string {
+	if p.UseAlt {
+		return p.mode + p.pad(p.AltPrompt)
+	}
+	return p.mode + p.pad(p.Prompt)
+}
+
+// Effective returns the prompt Readline prints in front of the first row as
+// things stand, which is AltPrompt when UseAlt is set, padded to line up as
+// Align says.
+func (p *Prompt) Effective() string {
+	return p.first()
+}
+
+// continuation returns the prompt shown in front of the rows after the first.
+func (p *Prompt) continuation() string {
+	return p.pad(p.AltPrompt)
+}
+
+func (p *Prompt) pad(s string) string {
+	n := max(visibleWidth(p.Prompt), visibleWidth(p.AltPrompt)) - visibleWidth(s)
+	switch {
+	case n <= 0:
+		return s
+	case p.Align == PromptAlignLeft:
+		return s + strings.Repeat(" ", n)
+	case p.Align == PromptAlignRight:
+		return strings.Repeat(" ", n) + s
+	}
+	return s
+}
+
+// Width returns how many columns the prompt in front of the first row takes
+// up on screen, leaving out any escape sequences.
+func (p *Prompt) Width() int {
+	return visibleWidth(p.first())
+}
+
+// ContinuationWidth is like Width for the rows after the first.
+func (p *Prompt) ContinuationWidth() int {
+	return visibleWidth(p.continuation())
+}
+
+// visibleWidth returns the width of s on screen, skipping escape sequences
+// such as colours.
+func visibleWidth(s string) int {
+	var w int
+	var esc, csi bool
+	for _, r := range s {
+		switch {
+		case csi:
+			// a CSI sequence ends with a byte from @ to ~
+			csi = r < 0x40 || r > 0x7e
+		case esc:
+			esc = false
+			csi = r == '['
+		case r == CharEsc:
+			esc = true
+		default:
+			w += runewidth.RuneWidth(r)
+		}
+	}
+	return w
+}
+
+func max(n, m int) int {
+	if n < m {
+		return m
+	}
+	return n
+}
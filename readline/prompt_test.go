@@ -0,0 +1,108 @@
+package readline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPromptAlign(t *testing.T) {
+	type testCase struct {
+		prompt       Prompt
+		first        string
+		continuation string
+	}
+
+	testCases := map[string]*testCase{
+		"none":       {Prompt{Prompt: ">>> ", AltPrompt: ". "}, ">>> ", ". "},
+		"left":       {Prompt{Prompt: ">>> ", AltPrompt: ". ", Align: PromptAlignLeft}, ">>> ", ".   "},
+		"right":      {Prompt{Prompt: ">>> ", AltPrompt: ". ", Align: PromptAlignRight}, ">>> ", "  . "},
+		"longer alt": {Prompt{Prompt: "> ", AltPrompt: "... ", Align: PromptAlignRight}, "  > ", "... "},
+		"use alt":    {Prompt{Prompt: ">>> ", AltPrompt: ". ", UseAlt: true, Align: PromptAlignLeft}, ".   ", ".   "},
+		"colour":     {Prompt{Prompt: "\x1b[1m>>>\x1b[0m ", AltPrompt: ". ", Align: PromptAlignLeft}, "\x1b[1m>>>\x1b[0m ", ".   "},
+		"wide":       {Prompt{Prompt: "世界 ", AltPrompt: "… ", Align: PromptAlignRight}, "世界 ", "   … "},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			if got := v.prompt.first(); got != v.first {
+				t.Fatalf("expected %q, got %q", v.first, got)
+			}
+
+			if got := v.prompt.continuation(); got != v.continuation {
+				t.Fatalf("expected %q, got %q", v.continuation, got)
+			}
+
+			if v.prompt.Width() != visibleWidth(v.first) || v.prompt.ContinuationWidth() != visibleWidth(v.continuation) {
+				t.Fatalf("expected widths %d and %d, got %d and %d", visibleWidth(v.first), visibleWidth(v.continuation), v.prompt.Width(), v.prompt.ContinuationWidth())
+			}
+		})
+	}
+}
+
+func TestEffective(t *testing.T) {
+	type testCase struct {
+		useAlt bool
+		align  PromptAlign
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"prompt":      {expect: ">>> "},
+		"alt":         {useAlt: true, expect: ". "},
+		"aligned alt": {useAlt: true, align: PromptAlignRight, expect: "  . "},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance("\r")
+			i.Prompt = &Prompt{Prompt: ">>> ", AltPrompt: ". ", UseAlt: v.useAlt, Align: v.align}
+
+			if got := i.Prompt.Effective(); got != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, got)
+			}
+
+			// it's what Readline prints
+			if _, err := i.Readline(); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(out.String(), v.expect) {
+				t.Fatalf("expected %q to be printed, got %q", v.expect, out.String())
+			}
+		})
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	testCases := map[string]int{
+		">>> ":                          4,
+		"\x1b[1m>>>\x1b[0m ":            4,
+		ColorGrey + "hi" + ColorDefault: 2,
+		"世界":                            4,
+		"":                              0,
+	}
+
+	for k, v := range testCases {
+		if got := visibleWidth(k); got != v {
+			t.Errorf("%q: expected %d, got %d", k, v, got)
+		}
+	}
+}
+
+func TestContinuationAlign(t *testing.T) {
+	var out bytes.Buffer
+	b, _ := NewBuffer(&Prompt{Prompt: ">>> ", AltPrompt: ". ", Align: PromptAlignLeft})
+	b.out = &out
+
+	b.AddString("one\ntwo")
+
+	if !strings.HasPrefix(out.String(), "one") || !strings.Contains(out.String(), "\r\n.   two") {
+		t.Fatalf("expected the rows to line up, got %q", out.String())
+	}
+
+	// moving up goes to the same column of the row above
+	b.MoveToStart()
+	if !strings.HasSuffix(out.String(), cursorUpN(1)+CursorBOL+cursorRightN(4)) {
+		t.Fatalf("expected the cursor after the prompt, got %q", out.String())
+	}
+}
@@ -5,25 +5,336 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type PlaceholderMode int
+
+const (
+	PlaceholderAlwaysWhenEmpty PlaceholderMode = iota
+	// PlaceholderAfterIdle waits for PlaceholderDelay without any input
+	PlaceholderAfterIdle
+	PlaceholderNever
+)
+
+// TimeoutAction is what Readline does once AutoSubmitAfter has passed.
+type TimeoutAction int
+
+const (
+	// TimeoutSubmit submits the line as if Enter had been pressed
+	TimeoutSubmit TimeoutAction = iota
+	// TimeoutError makes Readline return ErrTimeout
+	TimeoutError
 )
 
 type Prompt struct {
-	Prompt         string
-	AltPrompt      string
-	Placeholder    string
-	AltPlaceholder string
-	UseAlt         bool
+	Prompt           string
+	AltPrompt        string
+	Placeholder      string
+	AltPlaceholder   string
+	UseAlt           bool
+	PlaceholderMode  PlaceholderMode
+	PlaceholderDelay time.Duration
+
+	// Align pads the shorter of Prompt and AltPrompt to the width of the
+	// other so the input lines up across rows
+	Align PromptAlign
+
+	// shows the vi mode in front of the prompt while Readline is running
+	mode string
+}
+
+func (p *Prompt) placeholder() string {
+	if p.UseAlt {
+		return p.AltPlaceholder
+	}
+	return p.Placeholder
 }
 
 type Terminal struct {
 	outchan chan rune
+	pending []rune // runes looked at ahead of being read
+	out     io.Writer
+	fd      int // switched into raw mode while reading, or -1 to leave it alone
+	caps    TermCapabilities
+	piped   bool // input isn't a terminal so lines are read as they are
+	ttyOut  bool // out is a terminal, whatever the colour settings
+	input   pauser
+	stopper stopper
+	tty     *os.File // what the terminal was opened on, if not stdin
+	erase   rune     // the erase character set with stty, if it's known
+
+	done      chan struct{}   // closed by Close
+	cancel    <-chan struct{} // closed to stop reads, see Instance.Lines
+	stopped   chan struct{}   // closed once ioloop has returned
+	closeOnce sync.Once
+
+	mu             sync.Mutex
+	restore        func() error // puts the terminal back while it's in raw mode
+	bracketedPaste bool
+	err            error // why reading stopped
 }
 
+// Instance reads lines from a terminal. Its fields, and those of its Prompt
+// and History, can be changed freely between calls to Readline. While
+// Readline is running it handles one key at a time with the configuration as
+// it is when the key arrives, so changes from other goroutines have to be
+// made with Configure to wait for the key being handled. Callbacks such as
+// OnChange are called while a key is being handled and can change fields
+// directly, but mustn't call Configure.
 type Instance struct {
 	Prompt   *Prompt
 	Terminal *Terminal
 	History  *History
+
+	// OnChange is called with the line and cursor position whenever the line changes
+	OnChange func(line string, pos int)
+
+	// OnSubmit can rewrite the line when Enter is pressed. What it returns is
+	// wrapped in triple quotes if it was pasted, unless RawPaste is set, and
+	// then added to the history and returned by Readline.
+	OnSubmit func(line string) string
+
+	// RawPaste returns pasted text as it is. Otherwise triple quotes are put
+	// around it, before the first line of the paste and after the last, as
+	// ollama expects. The history gets the text just as it's returned.
+	RawPaste bool
+
+	// PreserveTrailingNewline keeps the newline that submitted a line on the
+	// end of what Readline returns, for writing lines back out exactly. By
+	// default lines are returned without the Enter or Ctrl+J that submitted
+	// them, and piped lines without their "\n" or "\r\n". With it, a typed
+	// line ends with "\n" and a piped line with whichever it had. A line the
+	// input ended in the middle of has no newline either way.
+	PreserveTrailingNewline bool
+
+	// PasteSink, if it's set, gets what's in a bracketed paste in place of
+	// the line, which gets PasteSinkMarker instead. It's for pastes too big
+	// to edit. Readline returns the error if writing to it fails.
+	PasteSink io.Writer
+
+	// SubmitWhenBalanced makes Enter start a new line instead of submitting
+	// while there are unclosed quotes or brackets
+	SubmitWhenBalanced bool
+
+	// EnterSplitsMidLine makes Enter, and Ctrl+J, split the line with a
+	// newline at the cursor unless the cursor is at the end of the last
+	// line, where it submits as usual. Only a submitted line is added to the
+	// history. Pasted text and Ctrl+O aren't affected.
+	EnterSplitsMidLine bool
+
+	// Completer returns the candidates for completing the word before the
+	// cursor when Tab is pressed.
+	Completer func(line string, pos int) []string
+
+	// CompletionFunc is like Completer but each candidate can say what goes
+	// after it once it's the only one left. It's used instead of Completer
+	// if both are set.
+	CompletionFunc func(line string, pos int) []Completion
+
+	// AutoCompleteTriggers bring up the menu of candidates as soon as one
+	// of them is typed, as Tab would, such as "." or "/".
+	AutoCompleteTriggers []rune
+
+	// SuggestFunc returns text to suggest, in grey, after the end of the line.
+	// It can be accepted with Tab or with the right arrow at the end of the line.
+	SuggestFunc func(line string) string
+
+	// SuggestMinChars is how many characters have to be typed before
+	// SuggestFunc is called, which is 1 when it's 0.
+	SuggestMinChars int
+
+	// CountFunc returns text to show on the row under the line, such as how
+	// many characters or tokens have been typed. It's called with the line
+	// after each key, and what it returns isn't part of the line. A menu or
+	// status shown by a key takes its place until the next key.
+	CountFunc func(line string) string
+
+	// OnUnknownSequence is called with the whole of an escape sequence that
+	// isn't recognised, such as "\x1b[24~" for F12. Returning true means it's
+	// been handled, otherwise it's skipped as it is without the callback.
+	OnUnknownSequence func(seq []rune) bool
+
+	// InsertTokens inserts the result of calling the function when escape,
+	// or Meta, is pressed followed by its key. Keys with a Meta binding of
+	// their own, such as b, f, d and r, keep it.
+	InsertTokens map[rune]func() string
+
+	// Colors are used for the placeholder, the suggestion and the status
+	Colors Colors
+
+	// StripPastedEscapes drops escape sequences, such as colours, from
+	// pasted text. Escape sequences that are typed still work.
+	StripPastedEscapes bool
+
+	// ClearScrollback makes Ctrl+L clear the scrollback as well as the screen
+	ClearScrollback bool
+
+	// HorizontalScroll scrolls long lines sideways instead of wrapping them
+	HorizontalScroll bool
+
+	// CaretNotation shows control characters in the line, such as those
+	// inserted with Ctrl+V, as ^ and a letter
+	CaretNotation bool
+
+	// AllowControlChars adds control characters that aren't bound to
+	// anything to the line, shown in caret notation, instead of dropping
+	// them. By default those are NUL (Ctrl+@ or Ctrl+Space), Ctrl+Q,
+	// Ctrl+T, Ctrl+\, Ctrl+], Ctrl+^ and Ctrl+_, and Ctrl+Z when the
+	// process can't be suspended.
+	AllowControlChars bool
+
+	// UnicodeWords makes the word commands, such as Meta-B, Meta-F and
+	// Ctrl+W, break words between scripts and at punctuation rather than
+	// only at spaces
+	UnicodeWords bool
+
+	// Keymap binds keys to actions in place of what they do by default,
+	// such as CharCtrlU to ActionKillWholeLine. Rebind changes it by the
+	// name of the action.
+	Keymap map[rune]Action
+
+	// Chords binds a prefix key, such as Ctrl+X, followed by another key to
+	// actions, in place of the defaults of Ctrl+X Ctrl+E for ActionEditLine.
+	// A key that isn't bound after the prefix does what it does on its own.
+	// A prefix that's bound with Keymap, or with Rebind, does what it's
+	// bound to instead of starting a chord unless there's a ChordTimeout.
+	Chords map[rune]map[rune]Action
+
+	// ChordTimeout is how long to wait for the key after a prefix. Once
+	// it's passed the prefix does what it does on its own. If it's 0 the
+	// wait is as long as it takes.
+	ChordTimeout time.Duration
+
+	// TTY is the terminal to read keys from and draw on, such as /dev/tty
+	// from OpenTTY when stdin or stdout has been redirected. Readline
+	// switches Terminal over to it when it's first used. If it's nil the
+	// terminal is stdin and stdout.
+	TTY *os.File
+
+	// OnShiftArrow is called with the arrows pressed with Shift, such as for
+	// a host extending a selection. Unless it returns true the key moves the
+	// cursor as the arrow would without Shift.
+	OnShiftArrow func(key Key) bool
+
+	// SessionLog records each line Readline returns with the time, including
+	// empty lines and those given up on with an interrupt or the end of the
+	// input, for auditing or debugging. SessionLogKeys records what's read
+	// for each key as well. Anything failing to be written is ignored.
+	SessionLog     io.Writer
+	SessionLogKeys bool
+
+	// Mask, when it's set, is drawn in place of every rune of the line, such
+	// as '*' for a password. Readline still returns the real text, but it's
+	// kept out of the history, and SessionLog has the runes, and the keys
+	// typed for them, replaced by Mask too.
+	Mask rune
+
+	// OnEnterRaw is called just after the terminal is put in raw mode and
+	// OnExitRaw just before it's taken out, such as for a host to switch
+	// to the alternate screen while reading. They're called in pairs,
+	// including around suspending and editing the line in $EDITOR, and
+	// OnExitRaw is called however Readline returns.
+	OnEnterRaw func()
+	OnExitRaw  func()
+
+	// Abbreviations are expanded in place when a word that matches one is
+	// finished by typing a space or the line is submitted, such as "gco"
+	// to "git checkout".
+	Abbreviations map[string]string
+
+	// MaxLength is the most runes a line can have, or 0 for no limit. Typing
+	// past it rings the bell, and PasteOverflow says what happens to a
+	// bracketed paste that goes past it. Anything else that would go past
+	// it, such as a yank, a completion or a history entry, is cut short.
+	MaxLength     int
+	PasteOverflow PasteOverflow
+
+	// ShellIntegration marks where the prompt starts and ends with OSC 133
+	// sequences, so whatever is driving the terminal can tell when it's
+	// ready for input
+	ShellIntegration bool
+
+	// EditMode picks emacs or vi key bindings. It's taken from the
+	// environment if left as EditModeDefault.
+	EditMode EditMode
+
+	// ViModeIndicator shows whether vi mode is in normal or insert mode by
+	// the shape of the cursor, which is put back once Readline returns, or
+	// by putting ViNormalPrompt or ViInsertPrompt in front of the prompt.
+	// New sets them to "[N] " and "[I] ".
+	ViModeIndicator ViIndicator
+	ViNormalPrompt  string
+	ViInsertPrompt  string
+
+	// MetaHighBit is for terminals that send Alt by setting the high bit of
+	// the key. A byte with that bit set, which isn't valid UTF-8, is then
+	// taken as Meta and the byte without it, so 0xe2 is Meta-b. Escape
+	// followed by the key is always understood as Meta.
+	MetaHighBit bool
+
+	// AutoSubmitAfter is how long Readline waits for a key before doing what
+	// OnTimeout says, such as for a kiosk. It's disabled if it's 0.
+	AutoSubmitAfter time.Duration
+	OnTimeout       TimeoutAction
+
+	// InterruptKey makes Readline return ErrInterrupt, EOFKey makes it
+	// return io.EOF if the line is empty, and SuspendKey stops the process
+	// until it's continued. Any of them can be set to 0 to disable it.
+	InterruptKey rune
+	EOFKey       rune
+	SuspendKey   rune
+
+	// text removed by the kill commands, kept between lines
+	kills killRing
+
+	// the line being edited while Readline is running
+	buf *Buffer
+
+	// what the line had in it when Readline returned, for SessionLog
+	edited string
+
+	// closed to stop Readline reading, for Lines
+	cancel <-chan struct{}
+
+	// set with SetStatus to show once Readline starts
+	status string
+
+	// a bracketed paste has started and not finished yet, and whether any
+	// of its lines have been added to the history
+	pasting     bool
+	pasteStored bool
+
+	// the paste went past MaxLength so the rest of it is dropped
+	pasteOverflowed bool
+
+	// how much of the paste has been written to PasteSink
+	sunk int
+
+	// when ReadlineTimeout gives up waiting for the line
+	deadline time.Time
+
+	// Ctrl+O submits the line and leaves the history entry after it to be
+	// recalled by the next call to Readline
+	recallNext bool
+	nextEntry  int
+
+	// keys are shown rather than acted on, see ShowKeyMode
+	showKeys bool
+
+	// drawn between StartSpinner and StopSpinner
+	spinner *spinner
+
+	// how many times PauseHistory has been called without ResumeHistory
+	historyPaused int
+
+	mu        sync.Mutex
+	closeOnce sync.Once
 }
 
 func New(prompt Prompt) (*Instance, error) {
@@ -38,217 +349,1374 @@ func New(prompt Prompt) (*Instance, error) {
 	}
 
 	return &Instance{
-		Prompt:   &prompt,
-		Terminal: term,
-		History:  history,
+		Prompt:         &prompt,
+		Terminal:       term,
+		History:        history,
+		InterruptKey:   CharInterrupt,
+		EOFKey:         CharDelete,
+		SuspendKey:     CharCtrlZ,
+		ViNormalPrompt: "[N] ",
+		ViInsertPrompt: "[I] ",
 	}, nil
 }
 
+// maxArg is the largest count that can be given with Meta and digits
+const maxArg = 1000
+
+// Readline reads a line, which is submitted with Enter or Ctrl+J. An empty
+// line is returned as "" with a nil error. Once the input has ended Readline
+// returns io.EOF, or the error reading it failed with, except for a line
+// that's been started but not submitted, which is returned first as if Enter
+// had been pressed. If the input isn't a terminal, lines are returned just
+// as they were read.
 func (i *Instance) Readline() (string, error) {
-	prompt := i.Prompt.Prompt
-	if i.Prompt.UseAlt {
-		prompt = i.Prompt.AltPrompt
+	// a spinner left running would draw over the prompt
+	i.StopSpinner()
+	i.edited = ""
+	line, err := i.readline()
+	if i.SessionLog != nil {
+		i.logLine(line, err)
 	}
-	fmt.Print(prompt)
+	return line, err
+}
 
-	fd := int(syscall.Stdin)
-	termios, err := SetRawMode(fd)
-	if err != nil {
-		return "", err
+func (i *Instance) readline() (string, error) {
+	if i.TTY != nil && i.Terminal.tty != i.TTY {
+		if err := i.useTTY(); err != nil {
+			return "", err
+		}
+	}
+	i.Terminal.cancel = i.cancel
+
+	if i.Terminal.piped {
+		return i.readPiped()
+	}
+
+	// held except while waiting for a key, so Refresh doesn't draw in the
+	// middle of an edit
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	viMode := i.editMode() == EditModeVi
+	if viMode && i.ViModeIndicator&ViIndicatorPrompt != 0 {
+		i.Prompt.mode = i.ViInsertPrompt
+		defer func() { i.Prompt.mode = "" }()
+	}
+
+	prompt := i.Prompt.first()
+	// writes go through out so a failing terminal stops Readline rather
+	// than leaving it drawing into nothing
+	out := &errWriter{w: i.Terminal.out}
+	if i.ShellIntegration {
+		fmt.Fprint(out, PromptStart+prompt+PromptEnd)
+	} else {
+		fmt.Fprint(out, prompt)
+	}
+
+	var suspend func() error
+	var cooked func(func() error) error // runs something with the terminal out of raw mode
+	if fd := i.Terminal.fd; fd >= 0 {
+		termios, err := SetRawMode(fd)
+		if err != nil {
+			return "", err
+		}
+		i.Terminal.erase = termios.eraseChar()
+		i.enterRaw()
+		// restored by the defer however Readline returns, even by panicking,
+		// or by Close
+		i.Terminal.setRestore(func() error {
+			i.exitRaw()
+			return UnsetRawMode(fd, termios)
+		})
+		defer i.Terminal.restoreMode()
+
+		suspend = func() error {
+			i.exitRaw()
+			if err := Suspend(fd, termios); err != nil {
+				return err
+			}
+			i.enterRaw()
+			return nil
+		}
+
+		cooked = func(f func() error) error {
+			i.exitRaw()
+			if err := UnsetRawMode(fd, termios); err != nil {
+				return err
+			}
+			err := f()
+			_, rawErr := SetRawMode(fd)
+			if rawErr == nil {
+				i.enterRaw()
+			} else if err == nil {
+				err = rawErr
+			}
+			return err
+		}
 	}
-	defer UnsetRawMode(fd, termios)
 
 	buf, _ := NewBuffer(i.Prompt)
+	buf.SetOutput(out)
+	i.buf = buf
+	defer func() { i.buf, i.edited = nil, buf.String() }()
+	buf.HorizontalScroll = i.HorizontalScroll
+	buf.CaretNotation = i.CaretNotation || i.AllowControlChars
+	buf.UnicodeWords = i.UnicodeWords
+	buf.MaxLength = i.MaxLength
+	buf.ShellIntegration = i.ShellIntegration
+	if i.Mask != 0 {
+		buf.MaskRune, buf.maskAll = i.Mask, true
+	}
+	buf.Colors = i.Colors
+	buf.color = i.Terminal.caps.Color
+	buf.colorDepth = i.Terminal.caps.depth()
 
-	var esc bool
-	var escex bool
-	var metaDel bool
+	var quoted bool // Ctrl+V was pressed so the next key is inserted as it is
+	var arg int     // the count typed as Meta and digits, for the next key
+	var chord rune  // the prefix of a chord that's been pressed, such as Ctrl+X
 	var pasteMode PasteMode
 
+	// the line and cursor from before a bracketed paste, for PasteReject
+	var pasteLine []rune
+	var pastePos int
+
+	// the line being typed, and where the cursor was in it, while the
+	// history is being looked through
 	var currentLineBuf []rune
+	var currentLinePos int
+
+	// origin is what Meta-R goes back to: the history entry that was last
+	// recalled, or the empty line Readline started with
+	var origin []rune
+	originPos := -1
+
+	revert := func() {
+		if originPos < 0 {
+			buf.Replace(nil)
+		} else {
+			buf.recall(origin, originPos)
+		}
+	}
+	var search *historySearch
+	var lastLine string
+
+	// historyPrev and historyNext walk through the history without drawing,
+	// so several steps can be drawn at once with historyShow
+	historyPrev := func() bool {
+		atEnd := i.History.Pos == i.History.Size()
+		if atEnd {
+			i.History.prefix = buf.String()
+		}
+		if i.History.prevShown(i.History.Pos) < 0 {
+			return false
+		}
+		if atEnd {
+			currentLineBuf, currentLinePos = []rune(buf.String()), buf.Pos
+		}
+		i.History.Prev()
+		return true
+	}
+
+	historyNext := func() bool {
+		if i.History.Pos >= i.History.Size() {
+			return false
+		}
+		i.History.Next()
+		return true
+	}
+
+	historyShow := func() {
+		if i.History.Pos == i.History.Size() {
+			origin, originPos = nil, -1
+			buf.Replace(currentLineBuf)
+			if pos := min(currentLinePos, buf.Size()); pos < buf.Pos {
+				buf.Pos = pos
+				buf.moveTo(buf.positions()[pos])
+			}
+		} else {
+			origin, originPos = i.History.entry(i.History.Pos), i.History.Pos
+			buf.recall(origin, originPos)
+		}
+	}
+
+	if i.status != "" {
+		buf.showStatus(i.status)
+		i.status = ""
+	}
+
+	// the prefix of the last walk through the history doesn't carry over
+	i.History.prefix = ""
+
+	if i.recallNext {
+		i.recallNext = false
+		if i.nextEntry < i.History.Size() {
+			i.History.Pos = i.nextEntry
+			historyShow()
+		}
+	}
+
+	var vi *viState
+	var viNormal bool // the mode that's been shown
+	if viMode {
+		vi = &viState{}
+		if i.ViModeIndicator&ViIndicatorCursor != 0 {
+			fmt.Fprint(out, CursorBar)
+			defer fmt.Fprint(out, CursorDefaultShape)
+		}
+	}
 
 	for {
-		if buf.IsEmpty() {
-			ph := i.Prompt.Placeholder
-			if i.Prompt.UseAlt {
-				ph = i.Prompt.AltPlaceholder
+		if out.err != nil {
+			return "", fmt.Errorf("writing to terminal: %w", out.err)
+		}
+
+		if vi != nil && vi.normal != viNormal {
+			viNormal = vi.normal
+			i.showViMode(buf, viNormal)
+		}
+
+		if i.OnChange != nil || i.SuggestFunc != nil {
+			if line := buf.String(); line != lastLine {
+				lastLine = line
+				if i.OnChange != nil {
+					i.OnChange(line, buf.Pos)
+				}
+				if i.SuggestFunc != nil {
+					var suggestion string
+					if buf.Size() >= max(i.SuggestMinChars, 1) {
+						suggestion = i.SuggestFunc(line)
+					}
+					buf.setSuggestion(suggestion)
+				}
+			}
+		}
+
+		if i.CountFunc != nil && search == nil && !buf.menu {
+			buf.showStatus(i.CountFunc(buf.String()))
+		}
+
+		var key Key
+		var err error
+		var first rune
+		var read, placeholder, eof, timedOut bool
+		var expired bool // the wait was cut short by ReadlineTimeout
+		var lone bool    // nothing followed the prefix within ChordTimeout
+		idle := time.Now()
+
+		if buf.IsEmpty() && search == nil && i.Prompt.placeholder() != "" {
+			switch i.Prompt.PlaceholderMode {
+			case PlaceholderAlwaysWhenEmpty:
+				placeholder = true
+			case PlaceholderAfterIdle:
+				delay := i.Prompt.PlaceholderDelay
+				if until := time.Until(i.deadline); !i.deadline.IsZero() && until < delay {
+					delay = until
+				}
+				i.mu.Unlock()
+				first, read, err = i.Terminal.readTimeout(delay)
+				i.mu.Lock()
+				placeholder = !read
 			}
-			fmt.Printf(ColorGrey + ph + fmt.Sprintf(CursorLeftN, len(ph)) + ColorDefault)
 		}
 
-		r, err := i.Terminal.Read()
+		if placeholder {
+			fmt.Fprint(out, buf.placeholder())
+		}
+
+		if !read && err == nil && chord != 0 && i.ChordTimeout > 0 {
+			i.mu.Unlock()
+			first, read, err = i.Terminal.readTimeout(i.ChordTimeout)
+			i.mu.Lock()
+			lone = !read
+		}
 
-		if buf.IsEmpty() {
-			fmt.Print(ClearToEOL)
+		if !read && !lone && err == nil && (i.AutoSubmitAfter > 0 || !i.deadline.IsZero()) {
+			// counted from when waiting started, including for the placeholder
+			wait := i.AutoSubmitAfter - time.Since(idle)
+			if until := time.Until(i.deadline); !i.deadline.IsZero() && (i.AutoSubmitAfter <= 0 || until <= wait) {
+				wait, expired = until, true
+			}
+			i.mu.Unlock()
+			first, read, err = i.Terminal.readTimeout(wait)
+			i.mu.Lock()
+			timedOut = !read
+		}
+
+		if lone {
+			key = Key{Code: CodeRune, Rune: chord, Seq: string(chord)}
+		}
+
+		if err == nil && !timedOut && !lone {
+			// the first rune can take as long as it likes but the rest of a
+			// sequence has to follow soon, so escape on its own is a key
+			var n int
+			key, err = DecodeKey(func() (rune, error) {
+				n += 1
+				switch {
+				case n == 1 && read:
+					return first, nil
+				case n == 1:
+					i.mu.Unlock()
+					defer i.mu.Lock()
+					return i.Terminal.Read()
+				case n == 2:
+					i.mu.Unlock()
+					defer i.mu.Lock()
+				}
+
+				r, ok, err := i.Terminal.readTimeout(sequenceTimeout)
+				if err == nil && !ok {
+					err = errSequenceTimeout
+				}
+				return r, err
+			})
+		}
+
+		if placeholder {
+			fmt.Fprint(out, ClearToEOL)
+		}
+
+		if err == nil && !timedOut && i.SessionLog != nil && i.SessionLogKeys {
+			i.logKey(key)
+		}
+
+		if err == errCanceled {
+			// the line is dropped, without going into the history
+			if !buf.IsEmpty() {
+				buf.MoveToEnd()
+				fmt.Fprintln(out)
+			}
+			return "", err
 		}
 
 		if err != nil {
-			return "", io.EOF
+			if buf.IsEmpty() {
+				return "", err
+			}
+
+			// the rest of the line is submitted as if Enter was pressed
+			key, eof = Key{Code: CodeRune, Rune: CharEnter}, true
+			quoted = false
 		}
 
-		if escex {
-			escex = false
+		if timedOut && expired {
+			// the line so far is returned so it isn't lost
+			buf.MoveToEnd()
+			fmt.Fprintln(out)
+			return buf.String(), ErrTimeout
+		}
 
-			switch r {
-			case KeyUp:
-				if i.History.Pos > 0 {
-					if i.History.Pos == i.History.Size() {
-						currentLineBuf = []rune(buf.String())
-					}
-					buf.Replace(i.History.Prev())
+		if timedOut {
+			if i.OnTimeout == TimeoutError {
+				return "", ErrTimeout
+			}
+			key, eof = Key{Code: CodeRune, Rune: CharEnter}, true
+			quoted = false
+		}
+
+		if key.Code == CodeRune && isRawByte(key.Rune) {
+			key = i.decodeByte(key)
+		}
+
+		if i.showKeys && !eof && !timedOut && !lone && (i.InterruptKey == 0 || !key.IsRune(i.InterruptKey)) {
+			buf.showStatus(describeKey(key))
+			continue
+		}
+
+		buf.dismissMenu()
+		i.kills.key()
+
+		// what's been given with Meta and digits only applies to this key
+		given, count := arg, max(arg, 1)
+		arg = 0
+		prefixed := chord
+		chord = 0
+
+		if quoted {
+			quoted = false
+			buf.AddString(key.Seq)
+			continue
+		}
+
+		if key.Code == CodeRune && i.Terminal.erase != 0 && key.Rune == i.Terminal.erase {
+			// Backspace and Ctrl+H erase whatever stty says, and so does
+			// the erase character it's set to
+			key.Rune = CharBackspace
+		}
+
+		if i.pasting && i.pasteOverflowed && key.Code != CodePasteEnd {
+			continue
+		}
+
+		if i.pasting && i.StripPastedEscapes && strings.HasPrefix(key.Seq, "\x1b") && key.Code != CodePasteEnd {
+			// CSI sequences have been read whole already
+			if key.Code == CodeRune && key.Meta && key.Rune == ']' {
+				i.Terminal.skipOSC()
+			}
+			continue
+		}
+
+		if i.pasting && i.PasteSink != nil && key.Code != CodePasteEnd {
+			if err := i.sink(key); err != nil {
+				// the rest of the paste is typed into the next line
+				i.endPaste()
+				return "", err
+			}
+			continue
+		}
+
+		if key.Code == CodeUnknown && i.OnUnknownSequence != nil && i.OnUnknownSequence([]rune(key.Seq)) {
+			continue
+		}
+
+		if search != nil {
+			switch r := key.Rune; {
+			case key.IsRune(CharBckSearch), key.IsRune(CharFwdSearch):
+				search.forward = r == CharFwdSearch
+				if search.forward {
+					search.find(i.History, search.pos+1)
+				} else {
+					search.find(i.History, search.pos-1)
 				}
-			case KeyDown:
-				if i.History.Pos < i.History.Size() {
-					buf.Replace(i.History.Next())
+			case key.IsRune(CharBackspace), key.IsRune(CharCtrlH):
+				if len(search.query) > 0 {
+					search.query = search.query[:len(search.query)-1]
+					search.pos = i.History.Size()
+					search.update(i.History)
+				}
+			case key.Code == CodeRune && !key.Meta && r >= CharSpace:
+				search.query = append(search.query, r)
+				search.update(i.History)
+			case key.Code == CodeRune && !key.Meta && i.boundTo(r) == ActionAbort:
+				// the line is put back as it was before the search
+				buf.Replace(search.line)
+				buf.Pos = search.linePos
+				buf.moveTo(buf.positions()[search.linePos])
+				fmt.Fprint(out, string(rune(CharBell)))
+				search = nil
+			default:
+				// any other key accepts the match and is then handled normally
+				if match := search.match(i.History); match != nil {
 					if i.History.Pos == i.History.Size() {
-						buf.Replace(currentLineBuf)
+						currentLineBuf, currentLinePos = search.line, len(search.line)
 					}
+					i.History.Pos = search.pos
+					origin, originPos = match, search.pos
+					buf.recall(match, search.pos)
+				} else {
+					buf.Replace(search.line)
 				}
-			case KeyLeft:
+				search = nil
+			}
+
+			if search != nil {
+				search.draw(out, i.History)
+				continue
+			}
+		}
+
+		if vi != nil && (key.Code == CodeEscape || key.Code == CodeRune && key.Meta) {
+			// escape leaves insert mode and whatever's typed after it is a
+			// command
+			if !vi.normal {
+				vi.normal = true
 				buf.MoveLeft()
-			case KeyRight:
-				buf.MoveRight()
-			case CharBracketedPaste:
-				var code string
-				for cnt := 0; cnt < 3; cnt++ {
-					r, err = i.Terminal.Read()
-					if err != nil {
-						return "", io.EOF
+			}
+			if key.Code == CodeEscape {
+				continue
+			}
+			key.Meta = false
+		}
+
+		if key.Shift && i.OnShiftArrow != nil && key.Code >= CodeUp && key.Code <= CodeLeft && i.OnShiftArrow(key) {
+			continue
+		}
+
+		if key.Code != CodeRune {
+			switch key.Code {
+			case CodeUp, CodeDown:
+				var moved bool
+				up := key.Code == CodeUp
+				for n := count; ; n = 1 {
+					for cnt := 0; cnt < n; cnt++ {
+						if up {
+							moved = historyPrev() || moved
+						} else {
+							moved = historyNext() || moved
+						}
 					}
 
-					code += string(r)
+					// skip drawing the entries in between while more arrows
+					// are already waiting, such as when the key is held down
+					next, ok := i.Terminal.queuedArrow()
+					if !ok {
+						break
+					}
+					up = next == KeyUp
 				}
-				if code == CharBracketedPasteStart {
-					pasteMode = PasteModeStart
-				} else if code == CharBracketedPasteEnd {
-					pasteMode = PasteModeEnd
+				if moved {
+					historyShow()
+				}
+			case CodeLeft:
+				for cnt := 0; cnt < count; cnt++ {
+					buf.MoveLeft()
+				}
+			case CodeRight:
+				if buf.Pos < buf.Size() || !buf.AcceptSuggestion() {
+					for cnt := 0; cnt < count; cnt++ {
+						buf.MoveRight()
+					}
 				}
-			case KeyDel:
-				if buf.Size() > 0 {
-					buf.Delete()
+			case CodePasteStart:
+				pasteMode = PasteModeStart
+				i.pasting = true
+				i.sunk = 0
+				pasteLine, pastePos = []rune(buf.String()), buf.Pos
+			case CodePasteEnd:
+				pasteMode = PasteModeEnd
+				if i.PasteSink != nil && i.pasting {
+					// none of it was submitted so it isn't wrapped
+					pasteMode = PastModeOff
+					buf.AddString(fmt.Sprintf(PasteSinkMarker, i.sunk))
+					i.sunk = 0
 				}
-				metaDel = true
-			case MetaStart:
+				i.pasting = false
+				i.pasteOverflowed = false
+			case CodeDelete:
+				// the Delete key always deletes forwards, unlike Ctrl+D it
+				// never ends input
+				buf.Delete()
+			case CodeHome:
 				buf.MoveToStart()
-			case MetaEnd:
+			case CodeEnd:
 				buf.MoveToEnd()
-			default:
-				// skip any keys we don't know about
-				continue
 			}
+			// any other keys are skipped
 			continue
-		} else if esc {
-			esc = false
+		}
 
-			switch r {
+		if key.Meta {
+			switch key.Rune {
+			case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				arg = min(given*10+int(key.Rune-'0'), maxArg)
 			case 'b':
-				buf.MoveLeftWord()
+				for cnt := 0; cnt < count; cnt++ {
+					buf.MoveLeftWord()
+				}
 			case 'f':
-				buf.MoveRightWord()
-			case CharEscapeEx:
-				escex = true
+				for cnt := 0; cnt < count; cnt++ {
+					buf.MoveRightWord()
+				}
+			case 'd':
+				i.kills.kill(buf.cut(buf.Pos, buf.nextWord(count)), false)
+			case 'r':
+				revert()
+			case CharBackspace, CharCtrlH:
+				i.kills.kill(buf.cut(buf.prevWord(count), buf.Pos), true)
+			default:
+				if token, ok := i.InsertTokens[key.Rune]; ok {
+					buf.AddString(token())
+				}
 			}
 			continue
 		}
 
-		switch r {
-		case CharNull:
+		r := key.Rune
+
+		if vi != nil && vi.normal && (r == CharLineStart || r == CharCtrlX) {
+			if r == CharLineStart {
+				buf.AdjustNumber(1)
+			} else {
+				buf.AdjustNumber(-1)
+			}
 			continue
-		case CharEsc:
-			esc = true
-		case CharInterrupt:
+		}
+
+		if vi != nil && vi.normal && r >= CharSpace {
+			switch r {
+			case 'k':
+				if historyPrev() {
+					historyShow()
+				}
+			case 'j':
+				if historyNext() {
+					historyShow()
+				}
+			default:
+				vi.command(buf, r)
+			}
+			continue
+		}
+
+		if i.InterruptKey != 0 && r == i.InterruptKey {
 			return "", ErrInterrupt
+		}
+
+		if i.EOFKey != 0 && r == i.EOFKey && buf.IsEmpty() {
+			return "", io.EOF
+		}
+
+		if i.SuspendKey != 0 && r == i.SuspendKey && suspend != nil {
+			buf.MoveToEnd()
+			fmt.Fprintln(out)
+			if err := suspend(); err != nil {
+				return "", err
+			}
+			buf.redraw()
+			continue
+		}
+
+		// an Enter made up for the end of the input or a timeout submits the
+		// line whatever the Enter key has been bound to
+		var a Action
+		var ok bool
+		switch {
+		case eof:
+		case prefixed != 0 && !lone:
+			a, ok = i.chordAction(prefixed, r)
+		case !lone && i.isPrefix(r):
+			chord = r
+			continue
+		}
+		if !ok && !eof {
+			a, ok = i.Keymap[r]
+		}
+
+		if ok && a == ActionEditLine {
+			// the line is edited in $VISUAL or $EDITOR, and whatever's
+			// wrong with the editor leaves the line as it was
+			buf.MoveToEnd()
+			fmt.Fprintln(out)
+			if line, err := i.editLine(buf.String(), cooked); err == nil {
+				buf.setLine([]rune(line))
+			} else {
+				fmt.Fprint(out, string(rune(CharBell)))
+			}
+			buf.redraw()
+			continue
+		}
+
+		if ok {
+			if i.do(buf, a, count) {
+				continue
+			}
+			// anything else is done the way its default key does it
+			if keys, ok := defaultKeys[a]; ok {
+				r = keys[0]
+			}
+		}
+
+		if r >= CharSpace && r != CharBackspace && i.pasting {
+			// the rest of what's been pasted so far is added along with it
+			// so a long paste isn't drawn a rune at a time
+			if !i.paste(buf, append([]rune{r}, i.Terminal.queuedText()...), pasteLine, pastePos) {
+				continue
+			}
+			r = CharEnter
+		}
+
+		switch r {
 		case CharLineStart:
 			buf.MoveToStart()
 		case CharLineEnd:
 			buf.MoveToEnd()
 		case CharBackward:
-			buf.MoveLeft()
+			for cnt := 0; cnt < count; cnt++ {
+				buf.MoveLeft()
+			}
 		case CharForward:
-			buf.MoveRight()
+			if buf.Pos < buf.Size() || !buf.AcceptSuggestion() {
+				for cnt := 0; cnt < count; cnt++ {
+					buf.MoveRight()
+				}
+			}
 		case CharBackspace, CharCtrlH:
-			buf.Remove()
+			for cnt := 0; cnt < count; cnt++ {
+				buf.Remove()
+			}
 		case CharTab:
-			// todo: convert back to real tabs
-			for cnt := 0; cnt < 8; cnt++ {
-				buf.Add(' ')
+			// the completer comes first, then the suggestion, then the placeholder
+			switch {
+			case i.Completer != nil, i.CompletionFunc != nil:
+				candidates := i.completions(buf.String(), buf.Pos)
+				if !buf.complete(candidates) {
+					if len(candidates) > 1 {
+						buf.showMenu(candidates)
+					} else {
+						fmt.Fprint(out, string(rune(CharBell)))
+					}
+				}
+			case buf.AcceptSuggestion():
+			case placeholder:
+				buf.AddString(i.Prompt.placeholder())
+			default:
+				// todo: convert back to real tabs
+				buf.AddString(strings.Repeat(" ", 8))
 			}
 		case CharDelete:
-			if buf.Size() > 0 {
-				buf.Delete()
-			} else {
-				return "", io.EOF
-			}
+			// Ctrl+D only gets here when the line isn't empty or EOFKey
+			// has been changed
+			buf.Delete()
 		case CharKill:
-			buf.DeleteRemaining()
+			i.do(buf, ActionKillLine, count)
 		case CharCtrlU:
-			buf.DeleteBefore()
+			i.do(buf, ActionUnixLineDiscard, count)
+		case CharCtrlY:
+			i.do(buf, ActionYank, count)
+		case CharCtrlV:
+			quoted = true
 		case CharCtrlL:
-			buf.ClearScreen()
+			buf.clearScreen(i.ClearScrollback)
 		case CharCtrlW:
-			buf.DeleteWord()
-		case CharEnter:
+			i.do(buf, ActionUnixWordRubout, count)
+		case CharCtrlG:
+			// Ctrl+G abandons whatever's in progress, such as a count,
+			// a chord, a menu or a vi operator, all of which have gone by
+			// now, and leaves the line alone
+			if vi != nil {
+				vi.operator = 0
+			}
+			fmt.Fprint(out, string(rune(CharBell)))
+		case CharCtrlX:
+			// on its own, once ChordTimeout has passed, it does nothing
+		case CharPrev, CharNext:
+			// Ctrl+P and Ctrl+N go through the history like Up and Down
+			var moved bool
+			for cnt := 0; cnt < count; cnt++ {
+				if r == CharPrev {
+					moved = historyPrev() || moved
+				} else {
+					moved = historyNext() || moved
+				}
+			}
+			if moved {
+				historyShow()
+			}
+		case CharBckSearch, CharFwdSearch:
+			search = newHistorySearch(i.History, []rune(buf.String()), r == CharFwdSearch)
+			search.linePos = buf.Pos
+			search.draw(out, i.History)
+		case CharEnter, CharCtrlJ, CharCtrlO:
+			if i.SubmitWhenBalanced && !eof && !balanced(buf.String()) {
+				buf.MoveToEnd()
+				buf.Add('\n')
+				continue
+			}
+
+			if i.EnterSplitsMidLine && !eof && !i.pasting && r != CharCtrlO && buf.Pos < buf.Size() {
+				buf.Add('\n')
+				continue
+			}
+
+			// how many entries there are from the one after the line being
+			// submitted to the newest, which Ctrl+O goes on to
+			var fromEnd int
+			if r == CharCtrlO && i.History.Pos < i.History.Size() {
+				fromEnd = i.History.Size() - i.History.nextShown(i.History.Pos)
+			}
+
+			if !i.pasting {
+				buf.expand(i.Abbreviations)
+			}
+
 			output := buf.String()
-			if output != "" {
-				i.History.Add([]rune(output))
+			if i.OnSubmit != nil {
+				output = i.OnSubmit(output)
 			}
-			buf.MoveToEnd()
-			fmt.Println()
-			switch pasteMode {
-			case PasteModeStart:
+			switch {
+			case i.RawPaste:
+			case pasteMode == PasteModeStart:
 				output = `"""` + output
-			case PasteModeEnd:
+			case pasteMode == PasteModeEnd:
 				output = output + `"""`
 			}
+			switch pasted := i.pasting || pasteMode != PastModeOff; {
+			case i.Mask != 0:
+			case i.historyPaused > 0:
+				// a paste carried on after resuming starts an entry of its own
+				i.pasteStored = false
+			case !pasted:
+				if output != "" {
+					i.History.Add([]rune(output))
+				}
+			case !i.History.StorePastes:
+			case i.pasteStored:
+				// the lines of a paste are kept together as one entry
+				i.History.appendLast([]rune(output))
+			case output != "":
+				i.pasteStored = i.History.add([]rune(output), time.Now().Unix())
+			}
+			if !i.pasting {
+				i.pasteStored = false
+			}
+
+			if fromEnd > 0 {
+				// counted from the end since adding the line can drop the
+				// oldest entry, and the line goes after the one to recall
+				i.nextEntry = i.History.Size() - fromEnd
+				if i.History.Pos == i.History.Size() {
+					i.nextEntry -= 1
+				}
+				i.recallNext = i.nextEntry >= 0
+			}
+
+			buf.MoveToEnd()
+			fmt.Fprintln(out)
+			if out.err != nil {
+				return "", fmt.Errorf("writing to terminal: %w", out.err)
+			}
+			if i.PreserveTrailingNewline && !eof {
+				output += "\n"
+			}
 			return output, nil
 		default:
-			if metaDel {
-				metaDel = false
-				continue
-			}
-			if r >= CharSpace || r == CharEnter {
+			insert := r >= CharSpace || i.AllowControlChars
+			switch {
+			case insert && i.MaxLength > 0 && buf.Size()+count > i.MaxLength:
+				fmt.Fprint(out, string(rune(CharBell)))
+			case insert && count > 1:
+				buf.AddString(strings.Repeat(string(r), count))
+			case insert || r == CharEnter:
+				if r == CharSpace {
+					buf.expand(i.Abbreviations)
+				}
 				buf.Add(r)
+				i.autoComplete(buf, r)
+			}
+		}
+	}
+}
+
+// balanced reports whether s has no unclosed quotes or brackets. Quotes and
+// brackets can be escaped with a backslash, and a single quote inside a word
+// is taken to be an apostrophe. Stray closing brackets are ignored since
+// typing more won't fix them.
+func balanced(s string) bool {
+	pairs := map[rune]rune{')': '(', ']': '[', '}': '{'}
+
+	var stack []rune
+	var quote rune
+	var escaped bool
+	var prev rune
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"', r == '\'' && !unicode.IsLetter(prev) && !unicode.IsDigit(prev):
+			quote = r
+		case r == '(', r == '[', r == '{':
+			stack = append(stack, r)
+		case pairs[r] != 0:
+			if len(stack) > 0 && stack[len(stack)-1] == pairs[r] {
+				stack = stack[:len(stack)-1]
 			}
 		}
+		prev = r
+	}
+
+	return quote == 0 && len(stack) == 0
+}
+
+// FromHistory returns the index of the history entry the line being edited
+// was recalled from, or false if it's been typed or edited since. It's meant
+// to be called from callbacks such as OnChange.
+func (i *Instance) FromHistory() (int, bool) {
+	if i.buf == nil {
+		return 0, false
+	}
+	return i.buf.FromHistory()
+}
+
+// Refresh draws the prompt and the line being edited again in place, such as
+// after the prompt has been changed or something else has been written over
+// it. It can be called from another goroutine while Readline is waiting for a
+// key, and does nothing if Readline isn't running.
+func (i *Instance) Refresh() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.buf != nil {
+		i.buf.refresh()
+	}
+}
+
+// ReplaceLine swaps the line being edited for s, with the cursor at cursor,
+// and draws it. Like Refresh it's for calling from another goroutine while
+// Readline is waiting for a key, such as once a completion has been worked
+// out. It reports false and does nothing if Readline isn't running.
+func (i *Instance) ReplaceLine(s string, cursor int) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.buf == nil {
+		return false
+	}
+
+	buf := i.buf
+	buf.suggestion = ""
+	buf.Replace([]rune(s))
+	if pos := max(cursor, 0); pos < buf.Pos {
+		buf.Pos = pos
+		buf.moveTo(buf.positions()[pos])
+	}
+	return true
+}
+
+func (i *Instance) enterRaw() {
+	if i.OnEnterRaw != nil {
+		i.OnEnterRaw()
+	}
+}
+
+func (i *Instance) exitRaw() {
+	if i.OnExitRaw != nil {
+		i.OnExitRaw()
+	}
+}
+
+// ReadlineTimeout is like Readline but gives up if the line hasn't been
+// submitted within d, returning ErrTimeout along with what had been typed so
+// far. The terminal is left as it was before, as it is after Readline.
+func (i *Instance) ReadlineTimeout(d time.Duration) (string, error) {
+	i.mu.Lock()
+	i.deadline = time.Now().Add(d)
+	i.mu.Unlock()
+
+	defer func() {
+		i.mu.Lock()
+		i.deadline = time.Time{}
+		i.mu.Unlock()
+	}()
+	return i.Readline()
+}
+
+// useTTY replaces Terminal with one on TTY.
+func (i *Instance) useTTY() error {
+	term, err := NewTTYTerminal(i.TTY)
+	if err != nil {
+		return err
+	}
+
+	i.Terminal.mu.Lock()
+	paste := i.Terminal.bracketedPaste
+	i.Terminal.mu.Unlock()
+
+	i.Terminal.Close()
+	i.Terminal = term
+	if paste {
+		term.EnableBracketedPaste()
 	}
+	return nil
+}
+
+// SetStatus shows msg on the row under the line until the next key, in
+// place of the completion menu if it's showing. Like Refresh it's for calling
+// from another goroutine while Readline is waiting for a key, and if
+// Readline isn't running msg is shown when it next starts.
+func (i *Instance) SetStatus(msg string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.buf != nil {
+		i.buf.showStatus(msg)
+	} else {
+		i.status = msg
+	}
+}
+
+// RenderedRows returns how many rows of the terminal the prompt and the line
+// being edited take up, such as for a host laying out the screen around it.
+// If Readline isn't running it's the one row the prompt goes on.
+func (i *Instance) RenderedRows() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.buf == nil {
+		return 1
+	}
+	return i.buf.RenderedRows()
+}
+
+// Reset clears any editing state left over from a previous call to Readline,
+// such as a half finished walk through the history or a paste that didn't
+// end, so the next call starts afresh. A status set with SetStatus isn't
+// shown. History entries, the kill ring and configuration are left alone.
+func (i *Instance) Reset() {
+	i.History.Pos = i.History.Size()
+	i.History.prefix = ""
+	i.recallNext = false
+	i.endPaste()
+	i.kills.killed, i.kills.appending = false, false
+	i.status = ""
+	i.deadline = time.Time{}
+}
+
+// Close puts the terminal back the way it was, stops reading from it and
+// saves the history if it has a file. It can be called more than once, and
+// while Readline is waiting for a key, in which case Readline returns io.EOF.
+// Like Configure it waits for any key being handled, so it mustn't be called
+// from callbacks such as OnSubmit.
+func (i *Instance) Close() error {
+	var err error
+	i.closeOnce.Do(func() {
+		i.StopSpinner()
+		err = i.Terminal.Close()
+
+		// the history is saved once a key that changes it has been handled
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		if i.History != nil && i.History.Filename != "" {
+			if saveErr := i.History.Save(); err == nil {
+				err = saveErr
+			}
+		}
+	})
+	return err
+}
+
+// Configure calls f with the instance once any key Readline is handling has
+// been dealt with, and holds the next one back until f returns. It's for
+// changing fields, such as Completer or Prompt, from another goroutine.
+func (i *Instance) Configure(f func(*Instance)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	f(i)
 }
 
+// HistoryEnable and HistoryDisable are safe to call from another goroutine
+// like Configure, which means they wait for the key being handled and so
+// mustn't be called from callbacks such as OnSubmit and OnChange. Those can
+// set History.Enabled directly instead.
 func (i *Instance) HistoryEnable() {
-	i.History.Enabled = true
+	i.Configure(func(i *Instance) {
+		i.History.Enabled = true
+	})
 }
 
 func (i *Instance) HistoryDisable() {
-	i.History.Enabled = false
+	i.Configure(func(i *Instance) {
+		i.History.Enabled = false
+	})
+}
+
+// PauseHistory stops submitted lines from being added to the history until
+// ResumeHistory is called as many times, without changing History.Enabled.
+// Both are safe to call from another goroutine like Configure.
+func (i *Instance) PauseHistory() {
+	i.Configure(func(i *Instance) {
+		i.historyPaused += 1
+	})
+}
+
+func (i *Instance) ResumeHistory() {
+	i.Configure(func(i *Instance) {
+		if i.historyPaused > 0 {
+			i.historyPaused -= 1
+		}
+	})
+}
+
+// WithoutHistory calls f, usually to read a line with Readline, with the
+// history paused, such as for a password.
+func (i *Instance) WithoutHistory(f func() (string, error)) (string, error) {
+	i.PauseHistory()
+	defer i.ResumeHistory()
+	return f()
 }
 
 func NewTerminal() (*Terminal, error) {
-	t := &Terminal{
-		outchan: make(chan rune),
+	fd := int(syscall.Stdin)
+	if !IsTerminal(fd) {
+		t := newTerminal(os.Stdin, os.Stdout)
+		t.piped = true
+		return t, nil
 	}
 
-	go t.ioloop()
+	t := newTerminal(newInput(os.Stdin), os.Stdout)
+	t.fd = fd
+	return t, nil
+}
+
+// NewTTYTerminal returns a terminal that reads keys from tty and draws on it,
+// rather than using stdin and stdout.
+func NewTTYTerminal(tty *os.File) (*Terminal, error) {
+	fd := int(tty.Fd())
+	if !IsTerminal(fd) {
+		return nil, fmt.Errorf("%s isn't a terminal", tty.Name())
+	}
 
+	t := newTerminal(newInput(tty), tty)
+	t.fd = fd
+	t.tty = tty
 	return t, nil
 }
 
-func (t *Terminal) ioloop() {
-	buf := bufio.NewReader(os.Stdin)
+func newTerminal(r io.Reader, w io.Writer) *Terminal {
+	t := &Terminal{
+		// buffered so that keys arriving together can be looked ahead at
+		outchan: make(chan rune, 64),
+		out:     w,
+		fd:      -1,
+		caps:    detectCapabilities(),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	t.caps.Color = colorEnabled(w)
+	t.ttyOut = isTerminal(w)
+	t.input, _ = r.(pauser)
+	t.stopper, _ = r.(stopper)
+
+	go t.ioloop(r)
+
+	return t
+}
+
+// ioloop sends what's read from r to outchan until Close is called. A read
+// that's already waiting when Close is called returns straight away if r is
+// a stopper, as the terminal's own input is, or else once the next key
+// arrives.
+func (t *Terminal) ioloop(r io.Reader) {
+	defer close(t.stopped)
+	buf := bufio.NewReader(r)
 
 	for {
-		r, _, err := buf.ReadRune()
+		r, size, err := buf.ReadRune()
+		if r == utf8.RuneError && size == 1 {
+			// kept as the byte it was so Readline can decode it as Meta
+			_ = buf.UnreadRune()
+			b, _ := buf.ReadByte()
+			r = rawByte + rune(b)
+		}
 		if err != nil {
+			// kept for Read to return once what's already been read runs out
+			t.mu.Lock()
+			t.err = err
+			t.mu.Unlock()
 			close(t.outchan)
 			break
 		}
-		t.outchan <- r
+
+		// anything read after closing is dropped
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+
+		select {
+		case t.outchan <- r:
+		case <-t.done:
+			return
+		}
 	}
 }
 
 func (t *Terminal) Read() (rune, error) {
-	r, ok := <-t.outchan
-	if !ok {
+	if len(t.pending) > 0 {
+		r := t.pending[0]
+		t.pending = t.pending[1:]
+		return r, nil
+	}
+
+	select {
+	case r, ok := <-t.outchan:
+		if !ok {
+			return 0, t.readErr()
+		}
+		return r, nil
+	case <-t.done:
 		return 0, io.EOF
+	case <-t.cancel:
+		return 0, errCanceled
 	}
+}
+
+// Err returns the error that stopped the terminal being read, which is
+// io.EOF if the input ended, or nil if it's still being read.
+func (t *Terminal) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
 
-	return r, nil
+func (t *Terminal) readErr() error {
+	if err := t.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// EnableBracketedPaste asks the terminal to mark pasted text so it can be
+// told apart from typing. It's turned off again by Close.
+func (t *Terminal) EnableBracketedPaste() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprint(t.out, StartBracketedPaste)
+	t.bracketedPaste = true
+}
+
+// Close turns off the modes the terminal was put in, takes it out of raw
+// mode if Readline is still running and stops reading from it. Reads after
+// Close return io.EOF.
+func (t *Terminal) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		if t.bracketedPaste {
+			fmt.Fprint(t.out, EndBracketedPaste)
+			t.bracketedPaste = false
+		}
+		t.mu.Unlock()
+
+		err = t.restoreMode()
+		close(t.done)
+		if t.stopper != nil {
+			t.stopper.stop()
+		}
+	})
+	return err
+}
+
+func (t *Terminal) setRestore(restore func() error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.restore = restore
+}
+
+// restoreMode takes the terminal out of raw mode if it's in it.
+func (t *Terminal) restoreMode() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.restore == nil {
+		return nil
+	}
+	err := t.restore()
+	t.restore = nil
+	return err
+}
+
+// pauser is input that can stop being read for a while.
+type pauser interface {
+	pause()
+	resume()
+}
+
+// stopper is input whose reads can be made to return io.EOF.
+type stopper interface {
+	stop()
+}
+
+// pause stops reading the terminal, where the input allows it, until resume
+// is called so that something else can read it.
+func (t *Terminal) pause() {
+	if t.input != nil {
+		t.input.pause()
+	}
+}
+
+func (t *Terminal) resume() {
+	if t.input != nil {
+		t.input.resume()
+	}
+}
+
+// EraseChar returns the terminal's erase character, as set with stty erase,
+// once Readline has put it into raw mode. It's 0 if it isn't known, or if
+// it's been set to something other than a control character, which is left
+// to be typed.
+func (t *Terminal) EraseChar() rune {
+	return t.erase
+}
+
+// Caps returns what the terminal is likely to support.
+func (t *Terminal) Caps() TermCapabilities {
+	return t.caps
+}
+
+// sequenceTimeout is how long to wait for the rest of a key sequence, which
+// can arrive in pieces over a slow connection
+const sequenceTimeout = 500 * time.Millisecond
+
+// readTimeout is like Read but gives up after d, in which case ok is false.
+func (t *Terminal) readTimeout(d time.Duration) (r rune, ok bool, err error) {
+	if len(t.pending) > 0 {
+		r, err := t.Read()
+		return r, true, err
+	}
+
+	select {
+	case r, ok := <-t.outchan:
+		if !ok {
+			return 0, true, t.readErr()
+		}
+		return r, true, nil
+	case <-t.done:
+		return 0, true, io.EOF
+	case <-t.cancel:
+		return 0, true, errCanceled
+	case <-time.After(d):
+		return 0, false, nil
+	}
+}
+
+// peek returns up to n runes which have already arrived without reading
+// them.
+func (t *Terminal) peek(n int) []rune {
+	for len(t.pending) < n {
+		select {
+		case r, ok := <-t.outchan:
+			if !ok {
+				return t.pending
+			}
+			t.pending = append(t.pending, r)
+		default:
+			return t.pending
+		}
+	}
+	return t.pending[:n]
+}
+
+// skipOSC reads the rest of an operating system command, such as one setting
+// the title or making a link, up to the BEL or ST which ends it.
+func (t *Terminal) skipOSC() {
+	var esc bool
+	for {
+		r, ok, err := t.readTimeout(sequenceTimeout)
+		if err != nil || !ok || r == CharBell || esc && r == '\\' {
+			return
+		}
+		esc = r == CharEsc
+	}
+}
+
+// queuedText reads the runes which have already arrived up to the first
+// one that isn't printable.
+func (t *Terminal) queuedText() []rune {
+	var text []rune
+	for {
+		next := t.peek(1)
+		if len(next) == 0 || next[0] < CharSpace || next[0] == CharBackspace || isRawByte(next[0]) {
+			return text
+		}
+		text = append(text, next[0])
+		t.pending = t.pending[1:]
+	}
+}
+
+// queuedArrow reads an up or down arrow if one has already arrived.
+func (t *Terminal) queuedArrow() (rune, bool) {
+	seq := t.peek(3)
+	if len(seq) < 3 || seq[0] != CharEsc || seq[1] != CharEscapeEx {
+		return 0, false
+	}
+
+	switch r := seq[2]; r {
+	case KeyUp, KeyDown:
+		t.pending = t.pending[3:]
+		return r, true
+	}
+	return 0, false
 }
@@ -0,0 +1,2033 @@
+package readline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func newTestInstance(input string) (*Instance, *bytes.Buffer) {
+	var out bytes.Buffer
+	return &Instance{
+		Prompt:       &Prompt{Prompt: ">>> ", AltPrompt: "... "},
+		Terminal:     newTerminal(strings.NewReader(input), &out),
+		History:      newTestHistory(),
+		InterruptKey: CharInterrupt,
+		EOFKey:       CharDelete,
+		SuspendKey:   CharCtrlZ,
+	}, &out
+}
+
+func TestOnChange(t *testing.T) {
+	i, _ := newTestInstance("abc\x7f\r")
+
+	var got []string
+	i.OnChange = func(line string, pos int) {
+		if pos != len(line) {
+			t.Errorf("expected cursor at %d, got %d", len(line), pos)
+		}
+		got = append(got, line)
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "ab" {
+		t.Fatalf("expected %q, got %q", "ab", line)
+	}
+
+	want := []string{"a", "ab", "abc", "ab"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSubmitWhenBalanced(t *testing.T) {
+	i, _ := newTestInstance("print(1\r2)\rf(x)\r")
+	i.SubmitWhenBalanced = true
+
+	for _, want := range []string{"print(1\n2)", "f(x)"} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != want {
+			t.Fatalf("expected %q, got %q", want, line)
+		}
+	}
+}
+
+func TestPreserveTrailingNewline(t *testing.T) {
+	type testCase struct {
+		input    string
+		preserve bool
+		expect   []string
+	}
+
+	testCases := map[string]*testCase{
+		"enter":             {"one\rtwo\n", false, []string{"one", "two"}},
+		"enter preserved":   {"one\rtwo\n", true, []string{"one\n", "two\n"}},
+		"empty preserved":   {"\r", true, []string{"\n"}},
+		"end of input":      {"one\rtwo", true, []string{"one\n", "two"}},
+		"multiple lines":    {"a\x16\nb\r", true, []string{"a\nb\n"}},
+		"not in history":    {"one\r\x1b[A\r", true, []string{"one\n", "one\n"}},
+		"end of input only": {"two", false, []string{"two"}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.PreserveTrailingNewline = v.preserve
+
+			for _, expect := range v.expect {
+				line, err := i.Readline()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if line != expect {
+					t.Fatalf("expected %q, got %q", expect, line)
+				}
+			}
+		})
+	}
+}
+
+func TestEnterSplitsMidLine(t *testing.T) {
+	type testCase struct {
+		input   string
+		expect  string
+		history []string
+	}
+
+	testCases := map[string]*testCase{
+		"end of line":  {"hello world\r", "hello world", []string{"hello world"}},
+		"middle":       {"hello world\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\r\x1b[F\r", "hello\n world", []string{"hello\n world"}},
+		"start":        {"hello\x01\r\x05\r", "\nhello", []string{"\nhello"}},
+		"ctrl j":       {"ab\x02\n\x05\n", "a\nb", []string{"a\nb"}},
+		"end of input": {"ab\x02", "ab", []string{"ab"}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.EnterSplitsMidLine = true
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			var history []string
+			for cnt := 0; cnt < i.History.Size(); cnt++ {
+				history = append(history, string(i.History.entry(cnt)))
+			}
+			if !reflect.DeepEqual(history, v.history) {
+				t.Fatalf("expected history %q, got %q", v.history, history)
+			}
+		})
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	testCases := map[string]bool{
+		`f(x)`:             true,
+		`f(x`:              false,
+		`{"a": [1, 2]}`:    true,
+		`{"a": [1, 2}`:     false,
+		`"unterminated`:    false,
+		`"esc\"aped"`:      true,
+		`"esc\"aped`:       false,
+		`'single'`:         true,
+		`don't stop`:       true,
+		`x = ')'`:          true,
+		`stray)`:           true,
+		`"a (b" + (c`:      false,
+		`escaped \( paren`: true,
+	}
+
+	for k, v := range testCases {
+		if got := balanced(k); got != v {
+			t.Errorf("%s: expected %t, got %t", k, v, got)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	// interrupted in the middle of a paste, after a kill
+	i, out := newTestInstance("\x1b[Aab\x17\x1b[200~one\rtw\x03next\x19\r")
+	i.RawPaste = true
+	i.History = newTestHistory("first", "second")
+
+	// the first line of the paste is submitted on its own
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.Readline(); err != ErrInterrupt {
+		t.Fatalf("expected %v, got %v", ErrInterrupt, err)
+	}
+
+	if !i.pasting || !i.pasteStored {
+		t.Fatalf("expected to be part way through the paste, got pasting %v", i.pasting)
+	}
+	i.History.Pos = 0
+	i.SetStatus("waiting")
+
+	i.Reset()
+
+	if i.History.Pos != i.History.Size() {
+		t.Fatalf("expected history position %d, got %d", i.History.Size(), i.History.Pos)
+	}
+
+	if i.History.Size() != 3 {
+		t.Fatalf("expected 3 history entries, got %d", i.History.Size())
+	}
+
+	if i.pasting || i.pasteStored || i.status != "" {
+		t.Fatalf("expected the paste and status to be forgotten, got pasting %v and status %q", i.pasting, i.status)
+	}
+
+	// the next line is typed rather than pasted, and the kill ring is kept
+	out.Reset()
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "nextsecondab" {
+		t.Fatalf("expected %q, got %q", "nextsecondab", line)
+	}
+	if i.History.Size() != 4 || strings.Contains(out.String(), "waiting") {
+		t.Fatalf("expected the line to be an entry of its own without the status, got %d entries and %q", i.History.Size(), out.String())
+	}
+}
+
+func TestPlaceholderWidth(t *testing.T) {
+	testCases := map[string]int{
+		"Send a message": 14,
+		"Envoyé":         6,
+		"メッセージを送信":       16,
+	}
+
+	for ph, width := range testCases {
+		i, out := newTestInstance("\r")
+		i.Prompt.Placeholder = ph
+
+		if _, err := i.Readline(); err != nil {
+			t.Fatal(err)
+		}
+
+		if expect := ph + fmt.Sprintf(CursorLeftN, width); !strings.Contains(out.String(), expect) {
+			t.Fatalf("expected %q, got %q", expect, out.String())
+		}
+	}
+}
+
+func TestEmptyPlaceholder(t *testing.T) {
+	// Ctrl+L draws the placeholder again along with the prompt
+	i, out := newTestInstance("\x0c\r")
+	i.Terminal.caps.Color = true
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out.String(), fmt.Sprintf(CursorLeftN, 0)) || strings.Contains(out.String(), ColorGrey) {
+		t.Fatalf("expected nothing drawn for the placeholder, got %q", out.String())
+	}
+}
+
+func TestPlaceholderMode(t *testing.T) {
+	type testCase struct {
+		mode  PlaceholderMode
+		delay time.Duration
+		want  bool
+	}
+
+	testCases := map[string]testCase{
+		"default":            {PlaceholderAlwaysWhenEmpty, 0, true},
+		"never":              {PlaceholderNever, 0, false},
+		"after idle, typing": {PlaceholderAfterIdle, time.Hour, false},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance("hi\r")
+			i.Terminal.caps.Color = true
+			i.Terminal.caps.Color256 = true
+			i.Prompt.Placeholder = "Send a message"
+			i.Prompt.PlaceholderMode = v.mode
+			i.Prompt.PlaceholderDelay = v.delay
+
+			if _, err := i.Readline(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.Contains(out.String(), ColorGrey+"Send a message"); got != v.want {
+				t.Fatalf("expected placeholder %t, got %t: %q", v.want, got, out.String())
+			}
+		})
+	}
+}
+
+func TestNoColorWhenPiped(t *testing.T) {
+	i, out := newTestInstance("he\r")
+	i.Prompt.Placeholder = "Send a message"
+	i.SuggestFunc = func(line string) string {
+		return "llo"
+	}
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "Send a message") {
+		t.Fatalf("expected the placeholder, got %q", out.String())
+	}
+
+	if strings.Contains(out.String(), "\x1b[38;") || strings.Contains(out.String(), ColorDefault) {
+		t.Fatalf("expected no colours, got %q", out.String())
+	}
+}
+
+func TestSuggestMinChars(t *testing.T) {
+	type testCase struct {
+		input  string
+		expect string
+		calls  []string
+	}
+
+	testCases := map[string]*testCase{
+		"too short":   {"he\x1b[C\r", "he", nil},
+		"long enough": {"hel\x1b[C\r", "hello", []string{"hel", "hello"}},
+		"deleted":     {"hel\x7f\x1b[C\r", "he", []string{"hel"}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.SuggestMinChars = 3
+
+			var calls []string
+			i.SuggestFunc = func(line string) string {
+				calls = append(calls, line)
+				return "hello"[len(line):]
+			}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			if !reflect.DeepEqual(calls, v.calls) {
+				t.Fatalf("expected calls %q, got %q", v.calls, calls)
+			}
+		})
+	}
+}
+
+func TestCountFunc(t *testing.T) {
+	i, out := newTestInstance("abc\x7f\x1b[200~xyz\x1b[201~\x01\x0b\r")
+	i.RawPaste = true
+	i.CountFunc = func(line string) string {
+		return fmt.Sprintf("[%d chars]", utf8.RuneCountInString(line))
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "" {
+		t.Fatalf("expected %q, got %q", "", line)
+	}
+
+	// the count is shown again after keys which don't change it
+	var counts []string
+	for _, m := range regexp.MustCompile(`\[(\d+) chars\]`).FindAllStringSubmatch(out.String(), -1) {
+		if len(counts) == 0 || counts[len(counts)-1] != m[1] {
+			counts = append(counts, m[1])
+		}
+	}
+
+	expect := []string{"0", "1", "2", "3", "2", "5", "0"}
+	if !reflect.DeepEqual(counts, expect) {
+		t.Fatalf("expected %q, got %q", expect, counts)
+	}
+}
+
+func TestInterruptKey(t *testing.T) {
+	i, _ := newTestInstance("a\x03b\x07")
+	i.InterruptKey = CharBell
+
+	line, err := i.Readline()
+	if err != ErrInterrupt {
+		t.Fatalf("expected %v, got %v", ErrInterrupt, err)
+	}
+
+	if line != "" {
+		t.Fatalf("expected empty line, got %q", line)
+	}
+}
+
+func TestEOFKey(t *testing.T) {
+	i, _ := newTestInstance("\x04hi\r\x04more\r")
+
+	i.EOFKey = 0
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "hi" {
+		t.Fatalf("expected %q, got %q", "hi", line)
+	}
+
+	i.EOFKey = CharDelete
+	if _, err := i.Readline(); err != io.EOF {
+		t.Fatalf("expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestEndOfInput(t *testing.T) {
+	type testCase struct {
+		input    string
+		balanced bool
+		expect   []string
+	}
+
+	testCases := map[string]*testCase{
+		"immediate":     {"", false, nil},
+		"empty line":    {"\n", false, []string{""}},
+		"empty cr":      {"\r", false, []string{""}},
+		"unsubmitted":   {"abc", false, []string{"abc"}},
+		"submitted":     {"abc\n", false, []string{"abc"}},
+		"crlf":          {"abc\r\n", false, []string{"abc", ""}},
+		"escape":        {"abc\x1b", false, []string{"abc"}},
+		"unbalanced":    {"(abc", true, []string{"(abc"}},
+		"several lines": {"one\ntwo\n\nthree", false, []string{"one", "two", "", "three"}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.SubmitWhenBalanced = v.balanced
+
+			for _, expect := range v.expect {
+				line, err := i.Readline()
+				if err != nil {
+					t.Fatalf("expected %q, got %v", expect, err)
+				}
+
+				if line != expect {
+					t.Fatalf("expected %q, got %q", expect, line)
+				}
+			}
+
+			// and it stays ended
+			for cnt := 0; cnt < 2; cnt++ {
+				if line, err := i.Readline(); line != "" || err != io.EOF {
+					t.Fatalf("expected %v, got %q, %v", io.EOF, line, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTab(t *testing.T) {
+	type testCase struct {
+		completer bool
+		suggest   bool
+		input     string
+		expect    string
+	}
+
+	testCases := map[string]*testCase{
+		"placeholder only":       {input: "\t\r", expect: "Send a message"},
+		"suggestion":             {suggest: true, input: "he\t\r", expect: "hello world"},
+		"suggestion placeholder": {suggest: true, input: "\t\r", expect: "Send a message"},
+		"completer":              {completer: true, suggest: true, input: "he\t\r", expect: "help"},
+		"spaces":                 {input: "a\t\r", expect: "a        "},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.Prompt.Placeholder = "Send a message"
+			if v.completer {
+				i.Completer = func(line string, pos int) []string {
+					return []string{"help"}
+				}
+			}
+			if v.suggest {
+				i.SuggestFunc = func(line string) string {
+					return strings.TrimPrefix("hello world", line)
+				}
+			}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
+
+// slowReader returns one byte per read, like a paste chunked over a slow link
+type slowReader struct {
+	data  string
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestBracketedPaste(t *testing.T) {
+	testCases := map[string]string{
+		"\x1b[200~pasted\r":         `"""pasted`,
+		"\x1b[200~one\x1b[201~\r":   `one"""`,
+		"\x1b[2~ab\r":               "ab",
+		"\x1b[200~\x1b[2;5~after\r": `"""after`,
+	}
+
+	for input, expect := range testCases {
+		var out bytes.Buffer
+		i, _ := newTestInstance("")
+		i.Terminal = newTerminal(&slowReader{data: input, delay: 5 * time.Millisecond}, &out)
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Errorf("%q: expected %q, got %q", input, expect, line)
+		}
+	}
+}
+
+func TestLargePaste(t *testing.T) {
+	pasted := strings.Repeat("abcd ", 20000)
+
+	var out bytes.Buffer
+	i, _ := newTestInstance("")
+	i.Terminal = newQueuedTerminal("[]\x1b[D\x1b[200~"+pasted+"\x1b[201~\r", &out)
+
+	var changes int
+	i.OnChange = func(line string, pos int) {
+		changes++
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "["+pasted+"]"+`"""` {
+		t.Fatalf("expected the paste inside the brackets, got %d runes", len(line))
+	}
+
+	// typing the brackets, then the paste all at once
+	if changes != 3 {
+		t.Fatalf("expected 3 changes, got %d", changes)
+	}
+}
+
+func TestStripPastedEscapes(t *testing.T) {
+	type testCase struct {
+		input  string
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"colours":   {"\x1b[200~\x1b[31mred\x1b[0m and \x1b[1;32mgreen\x1b[m\x1b[201~\r", `red and green"""`},
+		"link":      {"\x1b[200~\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\\x1b[201~\r", `link"""`},
+		"title":     {"\x1b[200~\x1b]0;title\x07text\x1b[201~\r", `text"""`},
+		"keys":      {"\x1b[200~up\x1b[A\x1b[Dleft\x1b[201~\r", `upleft"""`},
+		"typed":     {"ab\x1b[Dc\r", "acb"},
+		"multiline": {"\x1b[200~\x1b[1mone\rtwo\x1b[0m\x1b[201~\r", `"""one`},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.StripPastedEscapes = true
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+
+	// without it the sequence is taken as keys
+	i, _ := newTestInstance("\x1b[200~ab\x1b[Dc\x1b[201~\r")
+	if line, _ := i.Readline(); line != `acb"""` {
+		t.Fatalf("expected %q, got %q", `acb"""`, line)
+	}
+}
+
+func TestClearScrollback(t *testing.T) {
+	for _, scrollback := range []bool{false, true} {
+		i, out := newTestInstance("hi\x0c\r")
+		i.ClearScrollback = scrollback
+
+		if _, err := i.Readline(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(out.String(), ClearScreen) {
+			t.Fatalf("expected the screen to be cleared: %q", out.String())
+		}
+
+		if got := strings.Contains(out.String(), ClearScrollback); got != scrollback {
+			t.Fatalf("expected scrollback cleared %t, got %t: %q", scrollback, got, out.String())
+		}
+	}
+}
+
+func TestDeleteKey(t *testing.T) {
+	type testCase struct {
+		input  string
+		expect string
+		eof    bool
+	}
+
+	testCases := map[string]*testCase{
+		"delete key on empty line":   {input: "\x1b[3~\x1b[3~hi\r", expect: "hi"},
+		"delete key under cursor":    {input: "abc\x01\x1b[3~\r", expect: "bc"},
+		"delete key at end":          {input: "abc\x1b[3~\r", expect: "abc"},
+		"ctrl+d on empty line":       {input: "\x04hi\r", eof: true},
+		"ctrl+d under cursor":        {input: "abc\x01\x04\r", expect: "bc"},
+		"delete key then ctrl+d":     {input: "a\x01\x1b[3~\x04", eof: true},
+		"tilde after the delete key": {input: "\x1b[3~~\r", expect: "~"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+
+			line, err := i.Readline()
+			if v.eof {
+				if err != io.EOF {
+					t.Fatalf("expected %v, got %v", io.EOF, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
+
+func TestOnSubmit(t *testing.T) {
+	i, _ := newTestInstance("hello\r\x1b[200~pasted\r")
+	i.OnSubmit = strings.ToUpper
+
+	for _, expect := range []string{"HELLO", `"""PASTED`} {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+
+	for idx, expect := range []string{"HELLO", `"""PASTED`} {
+		v, _ := i.History.Buf.Get(idx)
+		if got := string(v.([]rune)); got != expect {
+			t.Fatalf("expected %q in the history, got %q", expect, got)
+		}
+	}
+}
+
+// newQueuedTerminal returns a terminal where all of the input has already
+// arrived, like a burst of keys from a key being held down.
+func newQueuedTerminal(input string, w io.Writer) *Terminal {
+	t := &Terminal{
+		outchan: make(chan rune, len(input)),
+		out:     w,
+		fd:      -1,
+	}
+	for _, r := range input {
+		t.outchan <- r
+	}
+	close(t.outchan)
+	return t
+}
+
+func TestHistoryBurst(t *testing.T) {
+	type testCase struct {
+		input   string
+		expect  string
+		skipped []string
+	}
+
+	testCases := map[string]*testCase{
+		"up":                {"\x1b[A\x1b[A\x1b[A\x1b[A\r", "two", []string{"five", "four", "three"}},
+		"up and down":       {"\x1b[A\x1b[A\x1b[A\x1b[A\x1b[B\r", "three", []string{"five", "four", "two"}},
+		"past the end":      {"\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\x1b[A\r", "one", []string{"five", "four", "three", "two"}},
+		"back to the draft": {"d\x1b[A\x1b[A\x1b[B\x1b[B\r", "d", []string{"five", "four"}},
+		"nowhere to go":     {"\x1b[B\x1b[B\r", "", nil},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance("")
+			i.Terminal = newQueuedTerminal(v.input, out)
+			i.History = newTestHistory("one", "two", "three", "four", "five")
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			for _, entry := range v.skipped {
+				if strings.Contains(out.String(), entry) {
+					t.Fatalf("expected %q not to be drawn, got %q", entry, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCtrlPN(t *testing.T) {
+	// each is typed with the arrows and again with Ctrl+P and Ctrl+N
+	testCases := map[string]string{
+		"up":                "\x1b[A\x1b[A\r",
+		"up and down":       "\x1b[A\x1b[A\x1b[A\x1b[B\r",
+		"past the end":      "\x1b[A\x1b[A\x1b[A\x1b[A\r",
+		"back to the draft": "draft\x1b[A\x1b[Ax\x1b[B\x1b[B\r",
+		"edited entry":      "\x1b[Ax\x1b[A\x1b[B\r",
+		"nowhere to go":     "\x1b[B\r",
+		"numeric argument":  "\x1b2\x1b[A\r",
+	}
+
+	read := func(input string) (string, int) {
+		i, _ := newTestInstance(input)
+		i.History = newTestHistory("one", "two", "three")
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return line, i.History.Pos
+	}
+
+	for name, input := range testCases {
+		arrows, arrowsPos := read(input)
+
+		keys := strings.NewReplacer("\x1b[A", "\x10", "\x1b[B", "\x0e").Replace(input)
+		line, pos := read(keys)
+		if line != arrows || pos != arrowsPos {
+			t.Fatalf("%s: expected %q at %d as with the arrows, got %q at %d", name, arrows, arrowsPos, line, pos)
+		}
+	}
+}
+
+func TestEmacsMovement(t *testing.T) {
+	type testCase struct {
+		emacs, arrow string
+	}
+
+	testCases := map[string]*testCase{
+		"Ctrl+B": {emacs: "\x02", arrow: "\x1b[D"},
+		"Ctrl+F": {emacs: "\x06", arrow: "\x1b[C"},
+		"Ctrl+A": {emacs: "\x01", arrow: "\x1b[H"},
+		"Ctrl+E": {emacs: "\x05", arrow: "\x1b[F"},
+		"Ctrl+P": {emacs: "\x10", arrow: "\x1b[A"},
+		"Ctrl+N": {emacs: "\x0e", arrow: "\x1b[B"},
+	}
+
+	// where the key is pressed, as % in each of these
+	inputs := []string{
+		"%X\r",
+		"abc%X\r",
+		"abc\x01%X\r",
+		"abc\x01%%X\r",
+		"ab\x1b[D%\x1b3%X\r",
+		"\x1b[A\x1b[A%X\r",
+		"draft\x1b[A%%X\r",
+		"sugg%\r",
+	}
+
+	read := func(input string) string {
+		i, _ := newTestInstance(input)
+		i.History = newTestHistory("one", "two", "three")
+		i.SuggestFunc = func(line string) string {
+			if line == "sugg" {
+				return "ested"
+			}
+			return ""
+		}
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return line
+	}
+
+	for name, tc := range testCases {
+		for _, input := range inputs {
+			arrow := read(strings.ReplaceAll(input, "%", tc.arrow))
+			if line := read(strings.ReplaceAll(input, "%", tc.emacs)); line != arrow {
+				t.Fatalf("%s in %q: expected %q as with the arrow, got %q", name, input, arrow, line)
+			}
+		}
+	}
+}
+
+func TestInsertTokens(t *testing.T) {
+	i, _ := newTestInstance("note \x1bt done\x1bb\x1bx\r")
+	i.InsertTokens = map[rune]func() string{
+		't': func() string { return "12:00" },
+		'x': func() string { return "[x] " },
+		'b': func() string { return "never used" },
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "note 12:00 [x] done"; line != expect {
+		t.Fatalf("expected %q, got %q", expect, line)
+	}
+}
+
+var errClosed = errors.New("closed")
+
+// failWriter fails once more than n bytes have been written
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errClosed
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteError(t *testing.T) {
+	for _, n := range []int{0, 4, 10, 15} {
+		i, _ := newTestInstance("")
+		i.Terminal = newTerminal(strings.NewReader("hello world\r"), &failWriter{n: n})
+
+		if _, err := i.Readline(); !errors.Is(err, errClosed) {
+			t.Fatalf("%d bytes: expected %v, got %v", n, errClosed, err)
+		}
+	}
+}
+
+func TestRevertLine(t *testing.T) {
+	type testCase struct {
+		input  string
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"recalled":         {"\x1b[AXX\x1b\x7f\x1br\r", "second"},
+		"recalled deleted": {"\x1b[A\x15\x1br\r", "second"},
+		"fresh":            {"abc\x1brd\r", "d"},
+		"back to draft":    {"draft\x1b[A\x1b[Bmore\x1br\r", ""},
+		"searched":         {"\x12fir\x1bxyz\x1br\r", "first"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.History = newTestHistory("first", "second")
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+		})
+	}
+}
+
+func TestRecallMultiline(t *testing.T) {
+	i, out := newTestInstance("")
+	i.Terminal = newTerminal(&slowReader{data: "\x1b[A\x1b[DX\r", delay: 5 * time.Millisecond}, out)
+	i.History = newTestHistory("short", "one line\ntwo")
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "one line\ntwXo"; line != expect {
+		t.Fatalf("expected %q, got %q", expect, line)
+	}
+
+	// recalled with the continuation prompt on the second row
+	if expect := ">>> one line" + ClearToEOL + "\r\n... two"; !strings.Contains(out.String(), expect) {
+		t.Fatalf("expected %q, got %q", expect, out.String())
+	}
+}
+
+func TestFromHistory(t *testing.T) {
+	i, out := newTestInstance("")
+	i.Terminal = newTerminal(&slowReader{data: "\x1b[A\x1b[Ax\x1b\x7f\x1br\x1b[B\x1b[B\r", delay: 5 * time.Millisecond}, out)
+	i.History = newTestHistory("first", "second")
+
+	type recall struct {
+		line string
+		pos  int
+		ok   bool
+	}
+
+	var got []recall
+	i.OnChange = func(line string, _ int) {
+		pos, ok := i.FromHistory()
+		got = append(got, recall{line, pos, ok})
+	}
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []recall{
+		{"second", 1, true},
+		{"first", 0, true},
+		{"firstx", 0, false},
+		{"", 0, false},
+		{"first", 0, true},
+		{"second", 1, true},
+		{"", 0, false},
+	}
+
+	if len(got) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+
+	for idx := range expect {
+		if got[idx].line != expect[idx].line || got[idx].ok != expect[idx].ok || (got[idx].ok && got[idx].pos != expect[idx].pos) {
+			t.Fatalf("expected %v, got %v", expect, got)
+		}
+	}
+
+	if _, ok := i.FromHistory(); ok {
+		t.Fatal("expected nothing to be recalled once Readline returns")
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written from more than one goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestClose(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.Terminal.EnableBracketedPaste()
+	i.History.Filename = filepath.Join(t.TempDir(), "history")
+	i.History.Add([]rune("ls"))
+
+	// stands in for the raw mode Readline switches a real terminal into
+	var restored int
+	i.Terminal.setRestore(func() error {
+		restored++
+		return nil
+	})
+
+	errs := make(chan error)
+	go func() {
+		_, err := i.Readline()
+		errs <- err
+	}()
+
+	for !strings.Contains(out.String(), ">>> ") {
+		time.Sleep(time.Millisecond)
+	}
+
+	for cnt := 0; cnt < 2; cnt++ {
+		if err := i.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("expected %v, got %v", io.EOF, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Readline to return once closed")
+	}
+
+	if restored != 1 {
+		t.Fatalf("expected the terminal to be restored once, got %d", restored)
+	}
+
+	if !strings.Contains(out.String(), EndBracketedPaste) {
+		t.Fatalf("expected bracketed paste to be turned off, got %q", out.String())
+	}
+
+	if saved, err := os.ReadFile(i.History.Filename); err != nil || string(saved) != "ls\n" {
+		t.Fatalf("expected the history to be saved, got %q, %v", saved, err)
+	}
+
+	// the reader stops as soon as its read returns
+	go w.Write([]byte("x"))
+	select {
+	case <-i.Terminal.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the reader to stop")
+	}
+
+	if _, err := i.Terminal.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected %v after closing, got %v", io.EOF, err)
+	}
+}
+
+func TestAcceptLineAndDown(t *testing.T) {
+	type testCase struct {
+		input  string
+		limit  int
+		expect []string
+	}
+
+	testCases := map[string]*testCase{
+		"next entry":  {"\x1b[A\x1b[A\x1b[A\x0f\x0f\r", 100, []string{"one", "two", "three"}},
+		"edited":      {"\x1b[A\x1b[A!\x0f\r", 100, []string{"two!", "three"}},
+		"dropped":     {"\x1b[A\x1b[A\x1b[A\x0f\x0f\r", 3, []string{"one", "two", "three"}},
+		"newest":      {"\x1b[A\x0fnew\r", 100, []string{"three", "new"}},
+		"typed":       {"typed\x0fnew\r", 100, []string{"typed", "new"}},
+		"interrupted": {"\x1b[A\x1b[A\x0f\x03\r", 100, []string{"two", "", ""}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+			i.History = newTestHistory("one", "two", "three")
+			i.History.Limit = v.limit
+
+			for _, expect := range v.expect {
+				line, err := i.Readline()
+				if err == ErrInterrupt {
+					i.Reset()
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				if line != expect {
+					t.Fatalf("expected %q, got %q", expect, line)
+				}
+			}
+		})
+	}
+}
+
+func TestDraftCursor(t *testing.T) {
+	testCases := map[string]string{
+		"hello world\x01\x1bf\x1b[A\x1b[BX\r":        "helloX world",
+		"hello world\x01\x1b[A\x1b[A\x1b[B\x1b[BX\r": "Xhello world",
+		"hello world\x1b[A\x1b[BX\r":                 "hello worldX",
+		"hello\x01\x1b[A!\x1b[BX\r":                  "Xhello",
+		"hello\x02\x1b[A\x1b[B\x1b[BX\r":             "hellXo",
+	}
+
+	for input, expect := range testCases {
+		i, _ := newTestInstance(input)
+		i.History = newTestHistory("one", "two")
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Errorf("%q: expected %q, got %q", input, expect, line)
+		}
+	}
+
+	// vi's j and k go back to the same place
+	t.Setenv("OLLAMA_EDIT_MODE", "vi")
+	i, _ := newTestInstance("hello world\x1b0wkjiX\r")
+	i.History = newTestHistory("one")
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "hello Xworld"; line != expect {
+		t.Fatalf("expected %q, got %q", expect, line)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.Prompt.PlaceholderMode = PlaceholderNever
+
+	// nothing to draw before Readline has started
+	i.Refresh()
+	if out.String() != "" {
+		t.Fatalf("expected nothing to be drawn, got %q", out.String())
+	}
+
+	lines := make(chan string)
+	go func() {
+		line, _ := i.Readline()
+		lines <- line
+	}()
+
+	w.Write([]byte("hello\x1b[D\x1b[D"))
+	for strings.Count(out.String(), cursorLeftN(1)) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	before := len(out.String())
+	i.Prompt.Prompt = "*** "
+	i.Refresh()
+
+	want := CursorHide + CursorBOL + "*** hello" + ClearToEOL + cursorLeftN(2) + CursorShow
+	if got := out.String()[before:]; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// editing carries on from where the cursor was
+	w.Write([]byte("!\r"))
+	if line := <-lines; line != "hel!lo" {
+		t.Fatalf("expected %q, got %q", "hel!lo", line)
+	}
+
+	after := len(out.String())
+	i.Refresh()
+	if len(out.String()) != after {
+		t.Fatalf("expected nothing to be drawn after Readline, got %q", out.String()[after:])
+	}
+}
+
+func TestReplaceLine(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+
+	if i.ReplaceLine("ignored", 0) {
+		t.Fatalf("expected nothing to be replaced before Readline has started")
+	}
+
+	changed := make(chan string, 10)
+	i.OnChange = func(line string, pos int) {
+		changed <- line
+	}
+
+	lines := make(chan string)
+	go func() {
+		line, _ := i.Readline()
+		lines <- line
+	}()
+
+	w.Write([]byte("hel"))
+	for <-changed != "hel" {
+	}
+
+	done := make(chan bool)
+	go func() {
+		done <- i.ReplaceLine("hello world", 5)
+	}()
+	if !<-done {
+		t.Fatalf("expected the line to be replaced")
+	}
+
+	// editing carries on from the new cursor
+	w.Write([]byte(",\r"))
+	if line := <-lines; line != "hello, world" {
+		t.Fatalf("expected %q, got %q", "hello, world", line)
+	}
+
+	if i.ReplaceLine("ignored", 0) {
+		t.Fatalf("expected nothing to be replaced after Readline")
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.Prompt.PlaceholderMode = PlaceholderNever
+	i.Completer = func(line string, pos int) []string {
+		return []string{"hello", "help"}
+	}
+
+	// shown as soon as Readline starts
+	i.SetStatus("waiting")
+
+	lines := make(chan string)
+	go func() {
+		line, _ := i.Readline()
+		lines <- line
+	}()
+
+	waitFor := func(s string) int {
+		t.Helper()
+		for cnt := 0; !strings.Contains(out.String(), s); cnt++ {
+			if cnt > 1000 {
+				t.Fatalf("expected %q, got %q", s, out.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return len(out.String())
+	}
+
+	status := ClearToEOL + "\r\n" + "waiting" + ClearToEOS + cursorUpN(1) + CursorBOL + cursorRightN(4)
+	waitFor("waiting")
+	if got := out.String(); got != ">>> "+status {
+		t.Fatalf("expected %q, got %q", ">>> "+status, got)
+	}
+
+	// the next key clears it
+	w.Write([]byte("he"))
+	waitFor(ClearToEOS + "he")
+	if got := out.String()[len(">>> "+status):]; !strings.Contains(got, ClearToEOS) {
+		t.Fatalf("expected the status to be cleared, got %q", got)
+	}
+
+	// and it takes the place of the completion menu
+	w.Write([]byte("\t\t"))
+	before := waitFor("help")
+	i.SetStatus("no matches")
+	after := waitFor("no matches")
+
+	status = ClearToEOL + "\r\n" + "no matches" + ClearToEOS + cursorUpN(1) + CursorBOL + cursorRightN(7)
+	if got := out.String()[before:after]; got != status {
+		t.Fatalf("expected %q, got %q", status, got)
+	}
+
+	w.Write([]byte("!\r"))
+	if line := <-lines; line != "hel!" {
+		t.Fatalf("expected %q, got %q", "hel!", line)
+	}
+	if got := out.String()[after:]; !strings.Contains(got, ClearToEOS) {
+		t.Fatalf("expected the status to be cleared, got %q", got)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.Completer = func(line string, pos int) []string {
+		return []string{"docker"}
+	}
+
+	const lines = 50
+	go func() {
+		for cnt := 0; cnt < lines; cnt++ {
+			w.Write([]byte("do\t\r"))
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for cnt := 0; cnt < lines; cnt++ {
+			candidate := "docker"
+			if cnt%2 == 1 {
+				candidate = "dolly"
+			}
+
+			i.Configure(func(i *Instance) {
+				i.Completer = func(line string, pos int) []string {
+					return []string{candidate}
+				}
+				i.Prompt.Prompt = fmt.Sprintf("\x1b[38;5;%dm>>>\x1b[0m ", cnt)
+			})
+
+			if cnt%2 == 0 {
+				i.HistoryDisable()
+			} else {
+				i.HistoryEnable()
+			}
+		}
+	}()
+
+	for cnt := 0; cnt < lines; cnt++ {
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != "docker" && line != "dolly" {
+			t.Fatalf("expected one of the candidates, got %q", line)
+		}
+	}
+	<-done
+}
+
+// errReader returns data and then fails with err.
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestTerminalErr(t *testing.T) {
+	failed := errors.New("read failed")
+
+	for _, piped := range []bool{false, true} {
+		for _, cause := range []error{failed, io.EOF} {
+			data := "hi\rbye"
+			if piped {
+				data = "hi\nbye"
+			}
+
+			var out bytes.Buffer
+			i, _ := newTestInstance("")
+			i.Terminal = newTerminal(&errReader{data: data, err: cause}, &out)
+			i.Terminal.piped = piped
+
+			for _, expect := range []string{"hi", "bye"} {
+				if line, err := i.Readline(); err != nil || line != expect {
+					t.Fatalf("expected %q, got %q, %v", expect, line, err)
+				}
+			}
+
+			if _, err := i.Readline(); err != cause {
+				t.Fatalf("expected %v, got %v", cause, err)
+			}
+
+			if err := i.Terminal.Err(); err != cause {
+				t.Fatalf("expected %v, got %v", cause, err)
+			}
+		}
+	}
+
+	// nothing's gone wrong while it's still being read
+	r, w := io.Pipe()
+	defer w.Close()
+	if err := newTerminal(r, io.Discard).Err(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestShellIntegration(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		i, out := newTestInstance("hi\r")
+		i.ShellIntegration = enabled
+
+		if _, err := i.Readline(); err != nil {
+			t.Fatal(err)
+		}
+
+		marked := strings.HasPrefix(out.String(), PromptStart+">>> "+PromptEnd)
+		if marked != enabled {
+			t.Fatalf("expected marks %v, got %q", enabled, out.String())
+		}
+		if !enabled && strings.Contains(out.String(), "\x1b]133;") {
+			t.Fatalf("expected no marks, got %q", out.String())
+		}
+	}
+}
+
+func TestShellIntegrationReprint(t *testing.T) {
+	type testCase struct {
+		input     string
+		newPrompt bool
+		expect    int
+	}
+
+	testCases := map[string]*testCase{
+		"once":         {"hi\r", false, 1},
+		"clear screen": {"h\x0ci\r", false, 2},
+		"new prompt":   {"hi\r", true, 2},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(v.input)
+			i.ShellIntegration = true
+			if v.newPrompt {
+				i.OnChange = func(line string, pos int) {
+					if line == "h" {
+						i.Prompt.Prompt = "> "
+					}
+				}
+			}
+
+			if _, err := i.Readline(); err != nil {
+				t.Fatal(err)
+			}
+
+			if n := strings.Count(out.String(), PromptStart); n != v.expect {
+				t.Fatalf("expected %d prompts marked, got %d: %q", v.expect, n, out.String())
+			}
+			if n := strings.Count(out.String(), PromptEnd); n != v.expect {
+				t.Fatalf("expected %d prompt ends marked, got %d: %q", v.expect, n, out.String())
+			}
+		})
+	}
+}
+
+func TestFailingSearch(t *testing.T) {
+	type testCase struct {
+		input   string
+		wrap    bool
+		expect  string
+		failing bool
+	}
+
+	testCases := map[string]*testCase{
+		"exhausted":        {input: "\x12git\x12\x12\r", expect: "git a", failing: true},
+		"wrapped":          {input: "\x12git\x12\x12\r", wrap: true, expect: "git b"},
+		"forward":          {input: "\x13git\x13\x13\r", expect: "git b", failing: true},
+		"forward wrapped":  {input: "\x13git\x13\x13\r", wrap: true, expect: "git a"},
+		"no match":         {input: "\x12gitx\r", expect: "git b", failing: true},
+		"no match wrapped": {input: "\x12gitx\r", wrap: true, expect: "git b", failing: true},
+		"recovered":        {input: "\x12gitx\x7f\x12\r", expect: "git a"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(v.input)
+			i.History = newTestHistory("git a", "ls", "git b")
+			i.History.SearchWrap = v.wrap
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			// the label of the last time the search was drawn
+			draws := strings.Split(out.String(), ClearLine+CursorBOL+"(")
+			label := draws[len(draws)-1]
+			label = label[:strings.Index(label, ")")]
+			if failing := strings.HasPrefix(label, "failing "); failing != v.failing {
+				t.Fatalf("expected failing %v, got %q", v.failing, label)
+			}
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	testCases := map[string]string{
+		"search":          "hello\x02\x12git\x07X\r",
+		"search moved on": "hello\x02\x12git\x12\x07X\r",
+		"failing search":  "hello\x02\x12gitzz\x07X\r",
+		"count":           "hellXoo\x1b3\x07\x7f\r",
+		"chord":           "hello\x02\x18\x07x\x7fX\r",
+		"nothing pending": "hello\x02\x07X\r",
+	}
+
+	for k, input := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, out := newTestInstance(input)
+			i.History = newTestHistory("git a", "ls", "git b")
+			i.Chords = map[rune]map[rune]Action{CharCtrlX: {'x': ActionKillWholeLine}}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != "hellXo" {
+				t.Fatalf("expected %q, got %q", "hellXo", line)
+			}
+
+			if !bytes.ContainsRune(out.Bytes(), CharBell) {
+				t.Fatalf("expected a bell, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestOnUnknownSequence(t *testing.T) {
+	type testCase struct {
+		input   string
+		handled bool
+		expect  string
+		seqs    []string
+	}
+
+	testCases := map[string]*testCase{
+		"f12":       {input: "a\x1b[24~b\r", handled: true, expect: "ab", seqs: []string{"\x1b[24~"}},
+		"unhandled": {input: "a\x1b[24~b\r", expect: "ab", seqs: []string{"\x1b[24~"}},
+		"modified":  {input: "\x1b[24;5~\x1bOQ\r", handled: true, seqs: []string{"\x1b[24;5~", "\x1bOQ"}},
+		"known":     {input: "ab\x1b[Dc\r", handled: true, expect: "acb"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			i, _ := newTestInstance(v.input)
+
+			var seqs []string
+			i.OnUnknownSequence = func(seq []rune) bool {
+				seqs = append(seqs, string(seq))
+				return v.handled
+			}
+
+			line, err := i.Readline()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			if !reflect.DeepEqual(seqs, v.seqs) {
+				t.Fatalf("expected %q, got %q", v.seqs, seqs)
+			}
+		})
+	}
+}
+
+func TestNumericArgument(t *testing.T) {
+	testCases := map[string]string{
+		"one two three four\x1b3\x1bbX\r":      "one Xtwo three four",
+		"one two three\x1b2\x17\r":             "one ",
+		"one two three\x1b2\x17\x19\r":         "one two three",
+		"one two three\x1b2\x1b\x7f\r":         "one ",
+		"one two three\x1b9\x1bbX\r":           "Xone two three",
+		"one two three\x1b0\x1bbX\r":           "one two Xthree",
+		"one two three\x01\x1b2\x1bfX\r":       "one twoX three",
+		"one two three\x01\x1b2\x1bd\r":        " three",
+		"abc\x1b2\x02X\r":                      "aXbc",
+		"abc\x1b2\x1b[DX\r":                    "aXbc",
+		"abcd\x1b2\x7f\r":                      "ab",
+		"\x1b3x\r":                             "xxx",
+		"\x1b1\x1b2x\r":                        strings.Repeat("x", 12),
+		"abc\x1b2\x01\x02X\r":                  "Xabc",
+		"one two\x1b2\x1b[D\x1b[D\x1b2\x06X\r": "one twXo",
+	}
+
+	for input, expect := range testCases {
+		i, _ := newTestInstance(input)
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Errorf("%q: expected %q, got %q", input, expect, line)
+		}
+	}
+}
+
+func TestAutoSubmitAfter(t *testing.T) {
+	type testCase struct {
+		action      TimeoutAction
+		placeholder PlaceholderMode
+		expect      string
+		err         error
+	}
+
+	testCases := map[string]*testCase{
+		"submit":      {action: TimeoutSubmit, expect: "ab"},
+		"error":       {action: TimeoutError, err: ErrTimeout},
+		"placeholder": {action: TimeoutSubmit, placeholder: PlaceholderAfterIdle, expect: "ab"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			r, w := io.Pipe()
+			defer w.Close()
+
+			i, out := newTestInstance("")
+			i.Terminal = newTerminal(r, out)
+			i.Prompt.PlaceholderMode = v.placeholder
+			i.Prompt.PlaceholderDelay = 10 * time.Millisecond
+			i.AutoSubmitAfter = 200 * time.Millisecond
+			i.OnTimeout = v.action
+
+			// b is only sent once a has been read, half way through the wait
+			typed := make(chan struct{}, 1)
+			i.OnChange = func(line string, pos int) {
+				if line == "a" {
+					typed <- struct{}{}
+				}
+			}
+
+			sent := make(chan time.Time, 1)
+			go func() {
+				w.Write([]byte("a"))
+				<-typed
+				time.Sleep(i.AutoSubmitAfter / 2)
+				sent <- time.Now()
+				w.Write([]byte("b"))
+			}()
+
+			line, err := i.Readline()
+			if err != v.err {
+				t.Fatalf("expected %v, got %v", v.err, err)
+			}
+
+			if line != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, line)
+			}
+
+			// the wait starts again after each key
+			if elapsed := time.Since(<-sent); elapsed < i.AutoSubmitAfter {
+				t.Fatalf("expected to wait %v after the last key, returned after %v", i.AutoSubmitAfter, elapsed)
+			}
+		})
+	}
+}
+
+func TestAutoSubmitAfterRebound(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	i, out := newTestInstance("")
+	i.Terminal = newTerminal(r, out)
+	i.AutoSubmitAfter = 50 * time.Millisecond
+	if err := i.Rebind("accept-line", Key{Code: CodeRune, Rune: CharCtrlJ}); err != nil {
+		t.Fatal(err)
+	}
+
+	// read before Readline starts, so the wait is only after the last key
+	w.Write([]byte("ab"))
+
+	// the line is submitted even though Enter no longer does it
+	done := make(chan string, 1)
+	go func() {
+		line, _ := i.Readline()
+		done <- line
+	}()
+
+	select {
+	case line := <-done:
+		if line != "ab" {
+			t.Fatalf("expected %q, got %q", "ab", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the line to be submitted after the timeout")
+	}
+}
+
+func TestAbbreviations(t *testing.T) {
+	testCases := map[string]string{
+		"gco ":          "git checkout ",
+		"gco":           "git checkout",
+		"git gco -b x ": "git git checkout -b x ",
+		"gcox ":         "gcox ",
+		"xgco ":         "xgco ",
+		"gcoo\x02 ":     "gco o",
+		"gco\x01 ":      " gco",
+		"gco \x7f ":     "git checkout ",
+	}
+
+	for input, expect := range testCases {
+		i, _ := newTestInstance(input + "\r")
+		i.Abbreviations = map[string]string{"gco": "git checkout"}
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Fatalf("expected %q, got %q", expect, line)
+		}
+	}
+}
+
+func TestPasteOverflow(t *testing.T) {
+	type testCase struct {
+		input    string
+		overflow PasteOverflow
+		expect   string
+	}
+
+	paste := "\x1b[200~0123456789\x1b[201~"
+	testCases := map[string]*testCase{
+		"truncate":        {input: "ab" + paste + "\r", overflow: PasteTruncate, expect: "ab012345"},
+		"reject":          {input: "ab" + paste + "\r", overflow: PasteReject, expect: "ab"},
+		"reject mid-line": {input: "ab\x02" + paste + "c\r", overflow: PasteReject, expect: "acb"},
+		"submit":          {input: "ab" + paste, overflow: PasteSubmit, expect: "ab012345"},
+		"lines":           {input: "\x1b[200~0123456789\r01\x1b[201~\r", overflow: PasteTruncate, expect: "01234567"},
+		"fits":            {input: "\x1b[200~0123\x1b[201~\r", overflow: PasteReject, expect: "0123"},
+		"typed":           {input: "0123456789\r", expect: "01234567"},
+	}
+
+	for name, tc := range testCases {
+		i, out := newTestInstance(tc.input)
+		i.MaxLength = 8
+		i.PasteOverflow = tc.overflow
+		i.RawPaste = true
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if line != tc.expect {
+			t.Fatalf("%s: expected %q, got %q", name, tc.expect, line)
+		}
+
+		rang := strings.Contains(out.String(), "\a")
+		if expect := tc.overflow == PasteReject && name != "fits" || name == "typed"; rang != expect {
+			t.Fatalf("%s: expected bell %v, got %v", name, expect, rang)
+		}
+	}
+}
+
+func TestMaxLengthInserted(t *testing.T) {
+	type testCase struct {
+		input  string
+		expect string
+	}
+
+	testCases := map[string]*testCase{
+		"history":      {"\x1b[A\r", "01234567"},
+		"yank":         {"abcdefg\x15xy\x19\r", "xyabcdef"},
+		"token":        {"ab\x1bt\r", "ab012345"},
+		"abbreviation": {"gco \r", "gco "},
+	}
+
+	for name, tc := range testCases {
+		i, _ := newTestInstance(tc.input)
+		i.MaxLength = 8
+		i.History.Add([]rune("0123456789"))
+		i.InsertTokens = map[rune]func() string{'t': func() string { return "0123456789" }}
+		i.Abbreviations = map[string]string{"gco": "git checkout"}
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if line != tc.expect {
+			t.Fatalf("%s: expected %q, got %q", name, tc.expect, line)
+		}
+	}
+}
+
+func TestPasteSink(t *testing.T) {
+	block := strings.Repeat(strings.Repeat("x", 99)+"\r", 10000)
+
+	i, out := newTestInstance("run " + "\x1b[200~" + block + "\x1b[201~" + " now\r")
+	var sink bytes.Buffer
+	i.PasteSink = &sink
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "run [pasted 1000000 bytes] now"; line != expect {
+		t.Fatalf("expected %q, got %q", expect, line)
+	}
+
+	if expect := strings.ReplaceAll(block, "\r", "\n"); sink.String() != expect {
+		t.Fatalf("expected %d bytes in the sink, got %d", len(expect), sink.Len())
+	}
+
+	if strings.Contains(out.String(), "xxx") {
+		t.Fatalf("expected the paste not to be drawn")
+	}
+
+	if entry := string(i.History.entry(i.History.Size() - 1)); entry != line {
+		t.Fatalf("expected %q in the history, got %q", line, entry)
+	}
+}
+
+func TestPasteSinkError(t *testing.T) {
+	i, _ := newTestInstance("\x1b[200~abc\x1b[201~\r\x1b[200~def\x1b[201~\r")
+	i.PasteSink = &failWriter{}
+	i.RawPaste = true
+
+	if _, err := i.Readline(); !errors.Is(err, errClosed) {
+		t.Fatalf("expected %v, got %v", errClosed, err)
+	}
+
+	// the paste is over, so what's left of it isn't written to the sink
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "" {
+		t.Fatalf("expected %q, got %q", "", line)
+	}
+
+	// and the next paste fails on its own
+	if _, err := i.Readline(); !errors.Is(err, errClosed) {
+		t.Fatalf("expected %v, got %v", errClosed, err)
+	}
+}
+
+func TestOnShiftArrow(t *testing.T) {
+	i, _ := newTestInstance("abc\x1b[1;2D\x1b[1;2Dx\x1b[DY\r")
+
+	var codes []KeyCode
+	i.OnShiftArrow = func(key Key) bool {
+		codes = append(codes, key.Code)
+		return len(codes) > 1
+	}
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first Shift+Left isn't handled so it moves the cursor, the second
+	// is and doesn't, and Left on its own isn't passed on
+	if expect := "abYxc"; line != expect {
+		t.Fatalf("expected %q, got %q", expect, line)
+	}
+	if expect := []KeyCode{CodeLeft, CodeLeft}; !reflect.DeepEqual(codes, expect) {
+		t.Fatalf("expected %v, got %v", expect, codes)
+	}
+}
+
+func TestReadlineTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	i, out := newTestInstance("")
+	i.Terminal = newTerminal(r, out)
+
+	// keys keep arriving but the line isn't submitted in time
+	go func() {
+		for _, c := range "abc" {
+			w.Write([]byte(string(c)))
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	line, err := i.ReadlineTimeout(100 * time.Millisecond)
+	if err != ErrTimeout {
+		t.Fatalf("expected %v, got %v", ErrTimeout, err)
+	}
+	if line != "abc" {
+		t.Fatalf("expected %q, got %q", "abc", line)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected to wait for the whole timeout, returned after %v", elapsed)
+	}
+
+	// the timeout doesn't carry over to Readline
+	go w.Write([]byte("d\r"))
+	line, err = i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "d" {
+		t.Fatalf("expected %q, got %q", "d", line)
+	}
+}
+
+func TestSessionLog(t *testing.T) {
+	i, _ := newTestInstance("ls\r\rrm\x03ab")
+	var log bytes.Buffer
+	i.SessionLog = &log
+
+	for {
+		if _, err := i.Readline(); err == io.EOF {
+			break
+		}
+	}
+
+	// the line that was left when the input ended was submitted
+	expect := []string{`submit "ls"`, `submit ""`, `interrupt "rm"`, `submit "ab"`, `eof ""`}
+	lines := strings.Split(strings.TrimSuffix(log.String(), "\n"), "\n")
+	if len(lines) != len(expect) {
+		t.Fatalf("expected %d lines, got %q", len(expect), lines)
+	}
+
+	for idx, line := range lines {
+		stamp, rest, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.RFC3339Nano, stamp); err != nil {
+			t.Fatalf("expected a timestamp, got %q: %v", line, err)
+		}
+		if rest != expect[idx] {
+			t.Fatalf("expected %q, got %q", expect[idx], rest)
+		}
+	}
+}
+
+func TestSessionLogKeys(t *testing.T) {
+	i, _ := newTestInstance("a\x1b[D\r")
+	var log bytes.Buffer
+	i.SessionLog = &log
+	i.SessionLogKeys = true
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{` key "a"`, ` key "\x1b[D"`, ` key "\r"`, ` submit "a"`} {
+		if !strings.Contains(log.String(), expect) {
+			t.Fatalf("expected %q in %q", expect, log.String())
+		}
+	}
+}
+
+func TestSessionLogError(t *testing.T) {
+	i, _ := newTestInstance("hi\r")
+	i.SessionLog = &failWriter{}
+	i.SessionLogKeys = true
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hi" {
+		t.Fatalf("expected %q, got %q", "hi", line)
+	}
+}
+
+func TestRenderedRowsIdle(t *testing.T) {
+	i, _ := newTestInstance("")
+	if rows := i.RenderedRows(); rows != 1 {
+		t.Fatalf("expected 1 row, got %d", rows)
+	}
+}
+
+func TestAutoCompleteTriggers(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.AutoCompleteTriggers = []rune{'.', '/'}
+
+	type call struct {
+		line string
+		pos  int
+	}
+	calls := make(chan call, 10)
+	i.Completer = func(line string, pos int) []string {
+		calls <- call{line, pos}
+		return []string{"os.path", "os.name"}
+	}
+
+	lines := make(chan string)
+	go func() {
+		line, _ := i.Readline()
+		lines <- line
+	}()
+
+	// the cursor is moved back first to show it's where the trigger was
+	// typed that's passed on
+	w.Write([]byte("osx\x1b[D"))
+	w.Write([]byte("."))
+	select {
+	case c := <-calls:
+		if c.line != "os.x" || c.pos != 3 {
+			t.Fatalf("expected %q at 3, got %q at %d", "os.x", c.line, c.pos)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the completer to be called")
+	}
+
+	for cnt := 0; !strings.Contains(out.String(), "os.name"); cnt++ {
+		if cnt > 1000 {
+			t.Fatalf("expected the menu, got %q", out.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w.Write([]byte("\r"))
+	if line := <-lines; line != "os.x" {
+		t.Fatalf("expected %q, got %q", "os.x", line)
+	}
+
+	select {
+	case c := <-calls:
+		t.Fatalf("expected no more calls, got %q at %d", c.line, c.pos)
+	default:
+	}
+}
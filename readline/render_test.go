@@ -0,0 +1,219 @@
+package readline
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// recordingRenderer takes the place of the terminal's output and keeps what's
+// written as a log of what it does, such as `print "x"` or "cursor-left 3",
+// so drawing can be checked without matching escape sequences byte for byte.
+type recordingRenderer struct {
+	ops     []string
+	pending []byte // the start of a sequence the rest of which is to come
+}
+
+func (r *recordingRenderer) Write(p []byte) (int, error) {
+	r.pending = append(r.pending, p...)
+	for len(r.pending) > 0 {
+		n := r.next(r.pending)
+		if n == 0 {
+			break
+		}
+		r.pending = r.pending[n:]
+	}
+	return len(p), nil
+}
+
+// next records the operation at the start of b and returns its length, or 0
+// if b ends partway through it.
+func (r *recordingRenderer) next(b []byte) int {
+	switch b[0] {
+	case '\r':
+		r.ops = append(r.ops, "carriage-return")
+		return 1
+	case '\n':
+		r.ops = append(r.ops, "newline")
+		return 1
+	case '\a':
+		r.ops = append(r.ops, "bell")
+		return 1
+	case '\b':
+		r.ops = append(r.ops, "backspace")
+		return 1
+	case '\033':
+		return r.escape(b)
+	}
+
+	// text up to the next control character is one operation
+	n := 0
+	for n < len(b) && b[n] >= ' ' && b[n] != 0x7f {
+		n++
+	}
+	if n == 0 {
+		r.ops = append(r.ops, fmt.Sprintf("control %#x", b[0]))
+		return 1
+	}
+	if n == len(b) && !utf8.FullRune(b[lastStart(b):]) {
+		// a rune split across writes is printed once all of it has arrived
+		n = lastStart(b)
+		if n == 0 {
+			return 0
+		}
+	}
+
+	r.ops = append(r.ops, "print "+strconv.Quote(string(b[:n])))
+	return n
+}
+
+// lastStart returns where the last rune in b starts.
+func lastStart(b []byte) int {
+	n := len(b) - 1
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return n
+}
+
+// escape records the escape sequence at the start of b.
+func (r *recordingRenderer) escape(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+
+	switch b[1] {
+	case '[':
+		for n := 2; n < len(b); n++ {
+			if b[n] >= 0x40 && b[n] <= 0x7e {
+				r.ops = append(r.ops, csiOp(string(b[2:n]), b[n]))
+				return n + 1
+			}
+		}
+		return 0
+	case ']':
+		// ended by BEL or by ST, which is escape and a backslash
+		for n := 2; n < len(b); n++ {
+			switch {
+			case b[n] == '\a':
+				r.ops = append(r.ops, "osc "+string(b[2:n]))
+				return n + 1
+			case b[n] == '\033' && n+1 < len(b) && b[n+1] == '\\':
+				r.ops = append(r.ops, "osc "+string(b[2:n]))
+				return n + 2
+			}
+		}
+		return 0
+	}
+
+	r.ops = append(r.ops, "escape "+string(b[1]))
+	return 2
+}
+
+// csiOp names the control sequence with the given parameters and final byte.
+func csiOp(params string, final byte) string {
+	n := 1
+	if v, err := strconv.Atoi(params); err == nil {
+		n = v
+	}
+
+	switch {
+	case final == 'A':
+		return fmt.Sprintf("cursor-up %d", n)
+	case final == 'B':
+		return fmt.Sprintf("cursor-down %d", n)
+	case final == 'C':
+		return fmt.Sprintf("cursor-right %d", n)
+	case final == 'D':
+		return fmt.Sprintf("cursor-left %d", n)
+	case final == 'E':
+		return "next-line"
+	case final == 'G':
+		return fmt.Sprintf("column %d", n)
+	case final == 'K' && params == "":
+		return "clear-eol"
+	case final == 'K' && params == "2":
+		return "clear-line"
+	case final == 'J' && params == "":
+		return "clear-eos"
+	case final == 'J' && params == "2":
+		return "clear-screen"
+	case final == 'J' && params == "3":
+		return "clear-scrollback"
+	case final == 'm' && (params == "" || params == "0"):
+		return "color-reset"
+	case final == 'm':
+		return "color " + params
+	case final == 'q' && strings.HasSuffix(params, " "):
+		return "cursor-shape " + strings.TrimSuffix(params, " ")
+	case final == 's':
+		return "save-cursor"
+	case final == 'u':
+		return "restore-cursor"
+	case final == 'f' || final == 'H':
+		return "cursor-to " + strings.ReplaceAll(params, ";", " ")
+	case params == "?25" && final == 'l':
+		return "hide-cursor"
+	case params == "?25" && final == 'h':
+		return "show-cursor"
+	case params == "?2004" && final == 'h':
+		return "bracketed-paste-on"
+	case params == "?2004" && final == 'l':
+		return "bracketed-paste-off"
+	}
+	return "csi " + params + string(final)
+}
+
+func TestRecordingRenderer(t *testing.T) {
+	var rec recordingRenderer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(strings.NewReader("ab\x7f\r"), &rec)
+	i.Terminal.caps.Color = true
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		`print ">>> "`,
+		`print "a"`,
+		`print "b"`,
+		"cursor-left 1",
+		"clear-eol",
+		"newline",
+	}
+	if !reflect.DeepEqual(rec.ops, expect) {
+		t.Fatalf("expected %q, got %q", expect, rec.ops)
+	}
+}
+
+func TestRecordingRendererWrites(t *testing.T) {
+	type testCase struct {
+		writes []string
+		expect []string
+	}
+
+	testCases := map[string]*testCase{
+		"text":      {writes: []string{"abc"}, expect: []string{`print "abc"`}},
+		"sequences": {writes: []string{"\033[3D\033[K\r"}, expect: []string{"cursor-left 3", "clear-eol", "carriage-return"}},
+		"split":     {writes: []string{"\033[", "2", "J"}, expect: []string{"clear-screen"}},
+		"rune":      {writes: []string{"\xe6\xbc", "\xa2"}, expect: []string{`print "漢"`}},
+		"osc":       {writes: []string{PromptStart}, expect: []string{"osc 133;A"}},
+		"osc st":    {writes: []string{"\033]8;;http://x\033", "\\a"}, expect: []string{"osc 8;;http://x", `print "a"`}},
+		"cursor":    {writes: []string{CursorHide + CursorShow}, expect: []string{"hide-cursor", "show-cursor"}},
+	}
+
+	for name, tc := range testCases {
+		var rec recordingRenderer
+		for _, w := range tc.writes {
+			rec.Write([]byte(w))
+		}
+
+		if !reflect.DeepEqual(rec.ops, tc.expect) {
+			t.Fatalf("%s: expected %q, got %q", name, tc.expect, rec.ops)
+		}
+	}
+}
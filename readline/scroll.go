@@ -0,0 +1,111 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scrolling reports whether the line should be scrolled sideways rather
+// than wrapped, which is only when HorizontalScroll is set and the line
+// doesn't fit on one row.
+func (b *Buffer) scrolling() bool {
+	if !b.HorizontalScroll || b.LineWidth < 3 {
+		return false
+	}
+
+	widths, _ := b.widths()
+	var width int
+	for cnt := 0; cnt < b.Size(); cnt++ {
+		if b.shown(cnt) == '\n' {
+			return false
+		}
+		width += widths[cnt]
+	}
+	return width >= b.LineWidth
+}
+
+// window returns the part of the line that's shown while scrolling, with <
+// and > where it's been cut off, and the column of the cursor within it. The
+// view only moves as far as it needs to keep the cursor in sight.
+func (b *Buffer) window() (string, int) {
+	// the last column is kept for >
+	last := b.LineWidth - 1
+
+	widths, joined := b.widths()
+	width := func(start, end int) int {
+		var w int
+		for cnt := start; cnt < end; cnt++ {
+			w += widths[cnt]
+		}
+		return w
+	}
+
+	indent := func(offset int) int {
+		if offset > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	if b.Pos < b.offset {
+		b.offset = b.Pos
+	}
+	// the view starts at the start of a grapheme cluster
+	for b.offset < b.Pos && indent(b.offset)+width(b.offset, b.Pos) >= last {
+		b.offset += 1
+		for b.offset < b.Pos && joined[b.offset] {
+			b.offset += 1
+		}
+	}
+	// don't leave space at the end if there's more to show on the left
+	for b.offset > 0 {
+		prev := b.offset - 1
+		for prev > 0 && joined[prev] {
+			prev -= 1
+		}
+		if indent(prev)+width(prev, b.Size()) >= last {
+			break
+		}
+		b.offset = prev
+	}
+
+	var sb strings.Builder
+	if b.offset > 0 {
+		sb.WriteString("<")
+	}
+
+	col := indent(b.offset)
+	cursor := col + width(b.offset, b.Pos)
+	for cnt := b.offset; cnt < b.Size(); cnt++ {
+		r := b.shown(cnt)
+		w := widths[cnt]
+		if col+w > last {
+			sb.WriteString(strings.Repeat(" ", last-col) + ">")
+			break
+		}
+		sb.WriteString(b.glyph(r))
+		col += w
+	}
+
+	return sb.String(), cursor
+}
+
+// drawScrolled draws the visible part of the line over the whole row.
+func (b *Buffer) drawScrolled() {
+	text, col := b.window()
+
+	clear := ClearToEOL
+	if b.rows > 0 {
+		clear = ClearToEOS
+	}
+
+	fmt.Fprint(b.out, cursorUpN(b.row)+CursorBOL+b.prompt()+text+clear+CursorBOL+cursorRightN(b.PromptSize()+col))
+
+	b.row, b.col, b.rows = 0, col, 0
+	b.menu = false
+	b.scrolled = true
+
+	// the whole row is drawn again once the line isn't scrolled
+	b.drawn = nil
+	b.endCol = b.LineWidth
+}
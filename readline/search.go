@@ -0,0 +1,88 @@
+package readline
+
+import (
+	"fmt"
+	"io"
+)
+
+// historySearch holds the state of an incremental history search, with
+// Ctrl+R or Ctrl+S.
+type historySearch struct {
+	query   []rune
+	pos     int
+	forward bool
+	line    []rune // buffer contents when the search was started
+	linePos int    // and where the cursor was in them
+
+	// failing is set when the last step found nothing, which leaves the
+	// previous match in place
+	failing bool
+}
+
+func newHistorySearch(h *History, line []rune, forward bool) *historySearch {
+	return &historySearch{
+		pos:     h.Size(),
+		forward: forward,
+		line:    line,
+	}
+}
+
+// find moves to the nearest entry matching the query, beginning at start.
+// The position is left alone, and the search is failing, if there's nothing
+// further to find. With the history's SearchWrap set it carries on from the
+// other end first.
+func (s *historySearch) find(h *History, start int) {
+	s.failing = false
+	if len(s.query) == 0 {
+		return
+	}
+
+	pos, ok := h.Search(string(s.query), start, s.forward)
+	if !ok && h.SearchWrap {
+		from := h.Size() - 1
+		if s.forward {
+			from = 0
+		}
+		pos, ok = h.Search(string(s.query), from, s.forward)
+	}
+
+	if ok {
+		s.pos = pos
+	} else {
+		s.failing = true
+	}
+}
+
+// update searches again after the query has changed, starting at the
+// current match.
+func (s *historySearch) update(h *History) {
+	start := s.pos
+	if start >= h.Size() {
+		start = h.Size() - 1
+		if s.forward {
+			start = 0
+		}
+	}
+	s.find(h, start)
+}
+
+// match returns the currently matched history entry, or nil if there isn't one.
+func (s *historySearch) match(h *History) []rune {
+	if s.pos < 0 || s.pos >= h.Size() {
+		return nil
+	}
+
+	return h.entry(s.pos)
+}
+
+func (s *historySearch) draw(w io.Writer, h *History) {
+	label := "reverse-i-search"
+	if s.forward {
+		label = "i-search"
+	}
+	if s.failing {
+		label = "failing " + label
+	}
+
+	fmt.Fprintf(w, ClearLine+CursorBOL+"(%s)`%s': %s", label, string(s.query), string(s.match(h)))
+}
@@ -0,0 +1,65 @@
+package readline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// logLine records what Readline returned in SessionLog, as the time, what
+// happened and the line, such as
+//
+//	2023-10-14T12:00:00.5Z submit "ls -l"
+//	2023-10-14T12:00:03.1Z interrupt "rm -"
+func (i *Instance) logLine(line string, err error) {
+	event := "submit"
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInterrupt):
+		event, line = "interrupt", i.edited
+	case errors.Is(err, io.EOF):
+		event, line = "eof", i.edited
+	case errors.Is(err, errCanceled):
+		event, line = "cancel", i.edited
+	case errors.Is(err, ErrTimeout):
+		event = "timeout"
+		if line == "" {
+			line = i.edited
+		}
+	default:
+		i.log("error", err.Error())
+		return
+	}
+	i.log(event, i.masked(line))
+}
+
+// logKey records what was read for key in SessionLog. With Mask, typing a
+// rune is recorded as Mask so the line can't be pieced together from it.
+func (i *Instance) logKey(key Key) {
+	if i.Mask != 0 && key.Code == CodeRune && !key.Meta && key.Rune >= CharSpace && key.Rune != CharBackspace {
+		i.log("key", string(i.Mask))
+		return
+	}
+	i.log("key", key.Seq)
+}
+
+// masked returns line with every rune but newlines replaced by Mask, if
+// it's set.
+func (i *Instance) masked(line string) string {
+	if i.Mask == 0 {
+		return line
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		return i.Mask
+	}, line)
+}
+
+func (i *Instance) log(event, text string) {
+	// a failing log mustn't get in the way of reading lines
+	fmt.Fprintf(i.SessionLog, "%s %s %q\n", time.Now().UTC().Format(time.RFC3339Nano), event, text)
+}
@@ -0,0 +1,36 @@
+package readline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShowKeyMode turns show-key mode on or off. While it's on, what each key
+// sends is shown under the line instead of the key being acted on, to find
+// out what a terminal sends for keys such as Home and End. InterruptKey
+// still interrupts, so there's a way out of it. Like Configure it's safe to
+// call from another goroutine.
+func (i *Instance) ShowKeyMode(on bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.showKeys = on
+}
+
+// describeKey returns what was read for k, with control characters in caret
+// notation, followed by its bytes in hex, such as "^[[A  1b 5b 41".
+func describeKey(k Key) string {
+	var shown strings.Builder
+	for _, r := range k.Seq {
+		if isControl(r) {
+			shown.WriteString(caret(r))
+		} else {
+			shown.WriteRune(r)
+		}
+	}
+
+	hex := make([]string, len(k.Seq))
+	for cnt := 0; cnt < len(k.Seq); cnt++ {
+		hex[cnt] = fmt.Sprintf("%02x", k.Seq[cnt])
+	}
+	return shown.String() + "  " + strings.Join(hex, " ")
+}
@@ -0,0 +1,72 @@
+package readline
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDescribeKey(t *testing.T) {
+	testCases := map[string]string{
+		"\x1b[A":  "^[[A  1b 5b 41",
+		"\x1b[1~": "^[[1~  1b 5b 31 7e",
+		"\x1bOH":  "^[OH  1b 4f 48",
+		"a":       "a  61",
+		"\x7f":    "^?  7f",
+		"\x01":    "^A  01",
+		"é":       "é  c3 a9",
+	}
+
+	for seq, expect := range testCases {
+		if got := describeKey(Key{Seq: seq}); got != expect {
+			t.Fatalf("expected %q, got %q", expect, got)
+		}
+	}
+}
+
+func TestShowKeyMode(t *testing.T) {
+	i, out := newTestInstance("\x1b[Ax\x03")
+	i.ShowKeyMode(true)
+
+	if _, err := i.Readline(); err != ErrInterrupt {
+		t.Fatalf("expected %v, got %v", ErrInterrupt, err)
+	}
+
+	for _, expect := range []string{"^[[A  1b 5b 41", "x  78"} {
+		if !strings.Contains(out.String(), expect) {
+			t.Fatalf("expected %q to be shown, got %q", expect, out.String())
+		}
+	}
+
+	if strings.Contains(out.String(), ">>> x") {
+		t.Fatalf("expected the key not to be typed, got %q", out.String())
+	}
+}
+
+func TestShowKeyModeOff(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.ShowKeyMode(true)
+
+	lines := make(chan string)
+	go func() {
+		line, _ := i.Readline()
+		lines <- line
+	}()
+
+	w.Write([]byte("\x1b[H"))
+	for !strings.Contains(out.String(), "^[[H  1b 5b 48") {
+		time.Sleep(time.Millisecond)
+	}
+
+	i.ShowKeyMode(false)
+	w.Write([]byte("hi\r"))
+	if line := <-lines; line != "hi" {
+		t.Fatalf("expected %q, got %q", "hi", line)
+	}
+}
@@ -0,0 +1,84 @@
+package readline
+
+import (
+	"fmt"
+	"time"
+)
+
+// spinnerFrames are drawn one after another while the spinner runs
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// spinnerInterval is how long each frame is shown for
+const spinnerInterval = 100 * time.Millisecond
+
+type spinner struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartSpinner draws an animated spinner followed by label on the current
+// line until StopSpinner is called, for while the host works on a line
+// Readline returned. The terminal isn't in raw mode then, so the line is
+// redrawn from its start with a carriage return. Starting it again changes
+// the label. It does nothing unless the output is a terminal, since
+// otherwise the frames would pile up in it.
+func (i *Instance) StartSpinner(label string) {
+	if !i.Terminal.ttyOut {
+		return
+	}
+
+	s := &spinner{stop: make(chan struct{}), done: make(chan struct{})}
+	i.mu.Lock()
+	old := i.spinner
+	i.spinner = s
+	i.mu.Unlock()
+
+	// the old one is stopped first so they don't draw over each other
+	if old != nil {
+		old.halt()
+	}
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+
+		for frame := 0; ; frame++ {
+			i.mu.Lock()
+			fmt.Fprint(i.Terminal.out, "\r"+spinnerFrames[frame%len(spinnerFrames)]+" "+label+ClearToEOL)
+			i.mu.Unlock()
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopSpinner stops the spinner and clears the line it was on, leaving the
+// cursor at the start of it. It does nothing if the spinner isn't running.
+func (i *Instance) StopSpinner() {
+	i.mu.Lock()
+	s := i.spinner
+	i.spinner = nil
+	i.mu.Unlock()
+
+	if s == nil {
+		return
+	}
+
+	s.halt()
+
+	i.mu.Lock()
+	fmt.Fprint(i.Terminal.out, "\r"+ClearToEOL)
+	i.mu.Unlock()
+}
+
+// halt stops the spinner drawing and waits until it has.
+func (s *spinner) halt() {
+	close(s.stop)
+	<-s.done
+}
@@ -0,0 +1,93 @@
+package readline
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpinner(t *testing.T) {
+	// without colour, as with NO_COLOR, it still spins on a terminal
+	i, out := newTestInstance("")
+	i.Terminal.ttyOut = true
+	i.Terminal.caps.Color = false
+
+	i.StartSpinner("thinking")
+	time.Sleep(2 * spinnerInterval)
+	i.StopSpinner()
+
+	if !strings.Contains(out.String(), "\r"+spinnerFrames[0]+" thinking"+ClearToEOL) {
+		t.Fatalf("expected the spinner, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "\r"+spinnerFrames[1]+" thinking"+ClearToEOL) {
+		t.Fatalf("expected the spinner to move, got %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "\r"+ClearToEOL) {
+		t.Fatalf("expected the line to be cleared, got %q", out.String())
+	}
+
+	// nothing is drawn once it's stopped
+	drawn := out.Len()
+	i.StopSpinner()
+	time.Sleep(2 * spinnerInterval)
+	if out.Len() != drawn {
+		t.Fatalf("expected nothing more, got %q", out.String()[drawn:])
+	}
+}
+
+func TestSpinnerReadline(t *testing.T) {
+	i, out := newTestInstance("hi\r")
+	i.Terminal.ttyOut = true
+
+	i.StartSpinner("thinking")
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "thinking"+ClearToEOL+"\r"+ClearToEOL) {
+		t.Fatalf("expected the spinner to be cleared before the prompt, got %q", out.String())
+	}
+	if i.spinner != nil {
+		t.Fatalf("expected the spinner to be stopped")
+	}
+}
+
+func TestSpinnerNoTerminal(t *testing.T) {
+	i, out := newTestInstance("")
+
+	i.StartSpinner("thinking")
+	time.Sleep(2 * spinnerInterval)
+	i.StopSpinner()
+
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing to be drawn, got %q", out.String())
+	}
+}
+
+func TestSpinnerConcurrent(t *testing.T) {
+	i, out := newTestInstance("")
+	i.Terminal.ttyOut = true
+
+	var wg sync.WaitGroup
+	for cnt := 0; cnt < 10; cnt++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.StartSpinner("thinking")
+		}()
+	}
+	wg.Wait()
+	i.StopSpinner()
+
+	// none of them is left running
+	i.mu.Lock()
+	drawn := out.Len()
+	i.mu.Unlock()
+	time.Sleep(2 * spinnerInterval)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if out.Len() != drawn {
+		t.Fatalf("expected nothing more, got %q", out.String()[drawn:])
+	}
+}
@@ -3,6 +3,8 @@
 package readline
 
 import (
+	"os"
+	"os/signal"
 	"syscall"
 )
 
@@ -25,12 +27,49 @@ func SetRawMode(fd int) (*Termios, error) {
 	return termios, setTermios(fd, &newTermios)
 }
 
+// eraseChar returns the erase character from termios, or 0 if it's disabled
+// or isn't a control character.
+func (t *Termios) eraseChar() rune {
+	r := rune(t.Cc[syscall.VERASE])
+	if r == 0 || r >= CharSpace && r != CharBackspace {
+		return 0
+	}
+	return r
+}
+
 func UnsetRawMode(fd int, termios *Termios) error {
 	return setTermios(fd, termios)
 }
 
+// OpenTTY opens the controlling terminal, which is there even when stdin
+// and stdout have been redirected.
+func OpenTTY() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
 // IsTerminal returns true if the given file descriptor is a terminal.
 func IsTerminal(fd int) bool {
 	_, err := getTermios(fd)
 	return err == nil
 }
+
+// Suspend puts the terminal back the way it was, stops the process and, once
+// it's been continued, switches the terminal into raw mode again.
+func Suspend(fd int, termios *Termios) error {
+	if err := UnsetRawMode(fd, termios); err != nil {
+		return err
+	}
+
+	cont := make(chan os.Signal, 1)
+	signal.Notify(cont, syscall.SIGCONT)
+	defer signal.Stop(cont)
+
+	// stop the whole process group the way the terminal would have
+	if err := syscall.Kill(0, syscall.SIGTSTP); err != nil {
+		return err
+	}
+	<-cont
+
+	_, err := SetRawMode(fd)
+	return err
+}
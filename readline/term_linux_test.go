@@ -0,0 +1,397 @@
+package readline
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPty returns both ends of a new pseudo terminal.
+func openPty(t *testing.T) (*os.File, *os.File) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo terminals:", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	var unlock int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Skip("can't unlock the pseudo terminal:", errno)
+	}
+
+	var n uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Skip("can't find the pseudo terminal:", errno)
+	}
+
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("can't open the pseudo terminal:", err)
+	}
+	t.Cleanup(func() { slave.Close() })
+
+	return master, slave
+}
+
+func TestCloseRestoresTerminal(t *testing.T) {
+	master, slave := openPty(t)
+	fd := int(slave.Fd())
+
+	before, err := getTermios(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(slave, io.Discard)
+	i.Terminal.fd = fd
+
+	errs := make(chan error)
+	go func() {
+		_, err := i.Readline()
+		errs <- err
+	}()
+
+	// wait for Readline to switch into raw mode
+	for {
+		termios, err := getTermios(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if termios.Lflag&syscall.ICANON == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := getTermios(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Lflag != before.Lflag || after.Iflag != before.Iflag {
+		t.Fatalf("expected the terminal to be restored, got lflag %#x and iflag %#x", after.Lflag, after.Iflag)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("expected %v, got %v", io.EOF, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Readline to return once closed")
+	}
+
+	// the terminal is back to reading whole lines
+	master.Write([]byte("x\n"))
+	select {
+	case <-i.Terminal.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the reader to stop")
+	}
+}
+
+func TestTTY(t *testing.T) {
+	master, slave := openPty(t)
+	fd := int(slave.Fd())
+
+	// stdin and stdout are redirected elsewhere
+	i, out := newTestInstance("ignored\r")
+	i.TTY = slave
+
+	lines := make(chan string)
+	errs := make(chan error)
+	go func() {
+		line, err := i.Readline()
+		if err != nil {
+			errs <- err
+			return
+		}
+		lines <- line
+	}()
+
+	// wait for Readline to switch the tty into raw mode
+	for {
+		termios, err := getTermios(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if termios.Lflag&syscall.ICANON == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	master.Write([]byte("hi\r"))
+
+	select {
+	case line := <-lines:
+		if line != "hi" {
+			t.Fatalf("expected %q, got %q", "hi", line)
+		}
+	case err := <-errs:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("expected a line from the tty")
+	}
+
+	if i.Terminal.tty != slave {
+		t.Fatal("expected the terminal to be on the tty")
+	}
+
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing drawn on stdout, got %q", out.String())
+	}
+
+	drawn := make(chan string)
+	go func() {
+		buf := make([]byte, 1024)
+		n, _ := master.Read(buf)
+		drawn <- string(buf[:n])
+	}()
+
+	select {
+	case s := <-drawn:
+		if !strings.Contains(s, ">>> ") {
+			t.Fatalf("expected the prompt drawn on the tty, got %q", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the prompt drawn on the tty")
+	}
+
+	i.Close()
+}
+
+func TestOpenTTY(t *testing.T) {
+	tty, err := OpenTTY()
+	if err != nil {
+		t.Skip("no controlling terminal:", err)
+	}
+	defer tty.Close()
+
+	term, err := NewTTYTerminal(tty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer term.Close()
+
+	if term.fd != int(tty.Fd()) {
+		t.Fatalf("expected fd %d, got %d", tty.Fd(), term.fd)
+	}
+}
+
+func TestReadlineTimeoutRestoresTerminal(t *testing.T) {
+	_, slave := openPty(t)
+	fd := int(slave.Fd())
+
+	before, err := getTermios(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(slave, io.Discard)
+	i.Terminal.fd = fd
+	defer i.Close()
+
+	if _, err := i.ReadlineTimeout(20 * time.Millisecond); err != ErrTimeout {
+		t.Fatalf("expected %v, got %v", ErrTimeout, err)
+	}
+
+	after, err := getTermios(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.Lflag != before.Lflag || after.Iflag != before.Iflag {
+		t.Fatalf("expected the terminal to be restored, got lflag %#x and iflag %#x", after.Lflag, after.Iflag)
+	}
+}
+
+func TestRawHooks(t *testing.T) {
+	master, slave := openPty(t)
+	fd := int(slave.Fd())
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(slave, io.Discard)
+	i.Terminal.fd = fd
+	defer i.Close()
+
+	var calls []string
+	raw := func() bool {
+		termios, err := getTermios(fd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return termios.Lflag&syscall.ICANON == 0
+	}
+	i.OnEnterRaw = func() { calls = append(calls, "enter "+strconv.FormatBool(raw())) }
+	i.OnExitRaw = func() { calls = append(calls, "exit "+strconv.FormatBool(raw())) }
+
+	// typed once Readline has put the terminal in raw mode, which drops
+	// anything typed before
+	typeRaw := func(s string) {
+		go func() {
+			for !raw() {
+				time.Sleep(time.Millisecond)
+			}
+			master.Write([]byte(s))
+		}()
+	}
+
+	typeRaw("hi\r")
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hi" {
+		t.Fatalf("expected %q, got %q", "hi", line)
+	}
+
+	// both are called while the terminal is in raw mode
+	if expect := []string{"enter true", "exit true"}; strings.Join(calls, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected %q, got %q", expect, calls)
+	}
+
+	// and on the way out after an interrupt
+	calls = nil
+	typeRaw("a\x03")
+	if _, err := i.Readline(); err != ErrInterrupt {
+		t.Fatalf("expected %v, got %v", ErrInterrupt, err)
+	}
+	if expect := []string{"enter true", "exit true"}; strings.Join(calls, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expected %q, got %q", expect, calls)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	_, slave := openPty(t)
+
+	type testCase struct {
+		w       io.Writer
+		term    string
+		noColor string
+		want    bool
+	}
+
+	testCases := map[string]testCase{
+		"terminal":       {slave, "xterm-256color", "", true},
+		"dumb terminal":  {slave, "dumb", "", false},
+		"NO_COLOR":       {slave, "xterm-256color", "1", false},
+		"empty NO_COLOR": {slave, "xterm-256color", "", true},
+		"pipe":           {io.Discard, "xterm-256color", "", false},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv("TERM", v.term)
+			t.Setenv("NO_COLOR", v.noColor)
+
+			if got := colorEnabled(v.w); got != v.want {
+				t.Fatalf("expected %t, got %t", v.want, got)
+			}
+		})
+	}
+}
+
+func TestColorsOnTerminal(t *testing.T) {
+	master, slave := openPty(t)
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("NO_COLOR", "")
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(strings.NewReader("hi\r"), slave)
+	i.Prompt.Placeholder = "Send a message"
+
+	if _, err := i.Readline(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	n, err := master.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out := string(buf[:n]); !strings.Contains(out, ColorGrey+"Send a message") {
+		t.Fatalf("expected the placeholder in grey, got %q", out)
+	}
+}
+
+func TestEraseChar(t *testing.T) {
+	type testCase struct {
+		erase  uint8
+		expect rune
+	}
+
+	testCases := map[string]testCase{
+		"delete":    {CharBackspace, CharBackspace},
+		"ctrl h":    {CharCtrlH, CharCtrlH},
+		"ctrl _":    {0x1f, 0x1f},
+		"disabled":  {0, 0},
+		"printable": {'#', 0},
+	}
+
+	for k, v := range testCases {
+		var termios Termios
+		termios.Cc[syscall.VERASE] = v.erase
+		if got := termios.eraseChar(); got != v.expect {
+			t.Fatalf("%s: expected %q, got %q", k, v.expect, got)
+		}
+	}
+}
+
+func TestEraseReadline(t *testing.T) {
+	master, slave := openPty(t)
+	fd := int(slave.Fd())
+
+	termios, err := getTermios(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	termios.Cc[syscall.VERASE] = 0x1f
+	if err := setTermios(fd, termios); err != nil {
+		t.Fatal(err)
+	}
+
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(slave, io.Discard)
+	i.Terminal.fd = fd
+	defer i.Close()
+
+	// typed once Readline has put the terminal in raw mode
+	go func() {
+		for {
+			termios, err := getTermios(fd)
+			if err == nil && termios.Lflag&syscall.ICANON == 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		master.Write([]byte("abcd\x1f\x7f\x08x\r"))
+	}()
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Backspace and Ctrl+H still erase along with the erase character
+	if line != "ax" {
+		t.Fatalf("expected %q, got %q", "ax", line)
+	}
+
+	if erase := i.Terminal.EraseChar(); erase != 0x1f {
+		t.Fatalf("expected the erase character %q, got %q", rune(0x1f), erase)
+	}
+}
@@ -1,6 +1,8 @@
 package readline
 
 import (
+	"errors"
+	"os"
 	"syscall"
 	"unsafe"
 )
@@ -56,7 +58,23 @@ func SetRawMode(fd int) (*State, error) {
 	return &State{st}, nil
 }
 
+// eraseChar returns 0 since the console has no erase character of its own.
+func (s *State) eraseChar() rune {
+	return 0
+}
+
 func UnsetRawMode(fd int, state *State) error {
 	_, _, err := syscall.SyscallN(procSetConsoleMode.Addr(), uintptr(fd), uintptr(state.mode), 0)
 	return err
 }
+
+// Suspend does nothing since there's no job control on Windows.
+func Suspend(fd int, state *State) error {
+	return nil
+}
+
+// OpenTTY isn't supported on Windows, where the console has separate input
+// and output handles.
+func OpenTTY() (*os.File, error) {
+	return nil, errors.New("no controlling terminal")
+}
@@ -9,6 +9,7 @@ const (
 	CharLineEnd   = 5
 	CharForward   = 6
 	CharBell      = 7
+	CharCtrlG     = 7
 	CharCtrlH     = 8
 	CharTab       = 9
 	CharCtrlJ     = 10
@@ -16,12 +17,15 @@ const (
 	CharCtrlL     = 12
 	CharEnter     = 13
 	CharNext      = 14
+	CharCtrlO     = 15
 	CharPrev      = 16
 	CharBckSearch = 18
 	CharFwdSearch = 19
 	CharTranspose = 20
 	CharCtrlU     = 21
+	CharCtrlV     = 22
 	CharCtrlW     = 23
+	CharCtrlX     = 24
 	CharCtrlY     = 25
 	CharCtrlZ     = 26
 	CharEsc       = 27
@@ -59,16 +63,30 @@ const (
 	CursorHide = "\033[?25l"
 	CursorShow = "\033[?25h"
 
-	ClearToEOL  = "\033[K"
-	ClearLine   = "\033[2K"
-	ClearScreen = "\033[2J"
-	CursorReset = "\033[0;0f"
+	// CursorBlock and CursorBar set the shape of the cursor, and
+	// CursorDefaultShape puts back the terminal's own
+	CursorBlock        = "\033[2 q"
+	CursorBar          = "\033[6 q"
+	CursorDefaultShape = "\033[0 q"
 
-	ColorGrey    = "\033[38;5;245m"
-	ColorDefault = "\033[0m"
+	ClearToEOL      = "\033[K"
+	ClearToEOS      = "\033[J"
+	ClearLine       = "\033[2K"
+	ClearScreen     = "\033[2J"
+	ClearScrollback = "\033[3J"
+	CursorReset     = "\033[0;0f"
+
+	ColorGrey        = "\033[38;5;245m"
+	ColorBrightBlack = "\033[90m" // grey for terminals with only the basic colours
+	ColorDefault     = "\033[0m"
 
 	StartBracketedPaste = "\033[?2004h"
 	EndBracketedPaste   = "\033[?2004l"
+
+	// PromptStart and PromptEnd are the OSC 133 shell integration marks
+	// either side of the prompt
+	PromptStart = "\033]133;A\007"
+	PromptEnd   = "\033]133;B\007"
 )
 
 const (
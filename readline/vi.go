@@ -0,0 +1,164 @@
+package readline
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type EditMode int
+
+const (
+	// EditModeDefault uses OLLAMA_EDIT_MODE if it's set to "vi" or "emacs",
+	// and emacs otherwise
+	EditModeDefault EditMode = iota
+	EditModeEmacs
+	EditModeVi
+)
+
+// editMode returns the edit mode to use, falling back to the environment
+// when the host hasn't picked one.
+func (i *Instance) editMode() EditMode {
+	if i.EditMode != EditModeDefault {
+		return i.EditMode
+	}
+
+	switch strings.ToLower(os.Getenv("OLLAMA_EDIT_MODE")) {
+	case "vi":
+		return EditModeVi
+	default:
+		return EditModeEmacs
+	}
+}
+
+// ViIndicator picks how vi mode shows which mode it's in.
+type ViIndicator int
+
+const (
+	// ViIndicatorCursor shows a block cursor in normal mode and a bar in
+	// insert mode
+	ViIndicatorCursor ViIndicator = 1 << iota
+	// ViIndicatorPrompt puts ViNormalPrompt or ViInsertPrompt in front of
+	// the prompt
+	ViIndicatorPrompt
+)
+
+// showViMode shows that the line has gone into normal or insert mode.
+func (i *Instance) showViMode(buf *Buffer, normal bool) {
+	if i.ViModeIndicator&ViIndicatorCursor != 0 {
+		shape := CursorBar
+		if normal {
+			shape = CursorBlock
+		}
+		fmt.Fprint(buf.out, shape)
+	}
+
+	if i.ViModeIndicator&ViIndicatorPrompt != 0 {
+		i.Prompt.mode = i.ViInsertPrompt
+		if normal {
+			i.Prompt.mode = i.ViNormalPrompt
+		}
+		buf.draw()
+	}
+}
+
+// viState is the state of vi editing. Readline starts each line in insert mode
+// where keys behave as they do in emacs mode, apart from escape.
+type viState struct {
+	normal bool
+
+	// operator is a pending 'd' or 'c' waiting for a motion
+	operator rune
+}
+
+// command runs a vi normal mode command.
+func (v *viState) command(buf *Buffer, r rune) {
+	if op := v.operator; op != 0 {
+		v.operator = 0
+		start := buf.Pos
+
+		switch r {
+		case op:
+			buf.MoveToStart()
+			buf.DeleteRemaining()
+		case 'w':
+			// like vi, cw only changes to the end of the word
+			if op == 'c' {
+				buf.MoveRightWord()
+			} else {
+				viNextWord(buf)
+			}
+			buf.remove(start, buf.Pos)
+			buf.Pos = start
+			buf.draw()
+		case 'b':
+			buf.DeleteWord()
+		case '0', '^':
+			buf.DeleteBefore()
+		case '$':
+			buf.DeleteRemaining()
+		default:
+			return
+		}
+
+		if op == 'c' {
+			v.normal = false
+		}
+		return
+	}
+
+	switch r {
+	case 'h':
+		buf.MoveLeft()
+	case 'l', ' ':
+		buf.MoveRight()
+	case 'w':
+		viNextWord(buf)
+	case 'b':
+		buf.MoveLeftWord()
+	case '0', '^':
+		buf.MoveToStart()
+	case '$':
+		buf.MoveToEnd()
+	case 'x':
+		buf.Delete()
+	case 'X':
+		buf.Remove()
+	case 'D':
+		buf.DeleteRemaining()
+	case 'd', 'c':
+		v.operator = r
+	case 'C':
+		buf.DeleteRemaining()
+		v.normal = false
+	case 'S':
+		buf.MoveToStart()
+		buf.DeleteRemaining()
+		v.normal = false
+	case 'i':
+		v.normal = false
+	case 'a':
+		buf.MoveRight()
+		v.normal = false
+	case 'I':
+		buf.MoveToStart()
+		v.normal = false
+	case 'A':
+		buf.MoveToEnd()
+		v.normal = false
+	}
+}
+
+// viNextWord moves to the start of the next word.
+func viNextWord(buf *Buffer) {
+	pos := buf.Pos
+	for pos < buf.Size() && !unicode.IsSpace(buf.runeAt(pos)) {
+		pos += 1
+	}
+	for pos < buf.Size() && unicode.IsSpace(buf.runeAt(pos)) {
+		pos += 1
+	}
+	buf.Pos = pos
+	buf.moveTo(buf.positions()[pos])
+}
@@ -0,0 +1,169 @@
+package readline
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditMode(t *testing.T) {
+	type testCase struct {
+		env      string
+		explicit EditMode
+		expect   EditMode
+	}
+
+	testCases := map[string]*testCase{
+		"unset":             {expect: EditModeEmacs},
+		"vi":                {env: "vi", expect: EditModeVi},
+		"uppercase":         {env: "VI", expect: EditModeVi},
+		"emacs":             {env: "emacs", expect: EditModeEmacs},
+		"unknown":           {env: "ed", expect: EditModeEmacs},
+		"explicit emacs":    {env: "vi", explicit: EditModeEmacs, expect: EditModeEmacs},
+		"explicit vi":       {env: "emacs", explicit: EditModeVi, expect: EditModeVi},
+		"explicit vi unset": {explicit: EditModeVi, expect: EditModeVi},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv("OLLAMA_EDIT_MODE", v.env)
+
+			i, _ := newTestInstance("")
+			i.EditMode = v.explicit
+
+			if got := i.editMode(); got != v.expect {
+				t.Fatalf("expected %v, got %v", v.expect, got)
+			}
+		})
+	}
+}
+
+func TestViMode(t *testing.T) {
+	testCases := map[string]string{
+		"hello\x1b0x\r":           "ello",
+		"hello\x1bX\r":            "helo",
+		"hello world\x1bbdw\r":    "hello ",
+		"hello world\x1bdd\r":     "",
+		"hello world\x1b0cwbye\r": "bye world",
+		"hello\x1bIsay \r":        "say hello",
+		"abc\x1b[Dx\r":            "abxc",
+		"hello\x1bhhhD\r":         "h",
+		"hello\x1b0Ahi\r":         "hellohi",
+		"typed\x1bq\r":            "typed",
+		"hello world\x1b0wC!\r":   "hello !",
+		"port 8080\x1b0\x01\r":    "port 8081",
+		"x9\x1b\x01\x01ax\r":      "x11x",
+		"1\x1b\x18\x18\r":         "-1",
+	}
+
+	for input, expect := range testCases {
+		t.Setenv("OLLAMA_EDIT_MODE", "vi")
+
+		i, _ := newTestInstance(input)
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Errorf("%q: expected %q, got %q", input, expect, line)
+		}
+	}
+}
+
+func TestViHistory(t *testing.T) {
+	i, _ := newTestInstance("draft\x1bkkj\r")
+	i.EditMode = EditModeVi
+	i.History = newTestHistory("first", "second")
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line != "second" {
+		t.Fatalf("expected %q, got %q", "second", line)
+	}
+}
+
+func TestViModeIndicator(t *testing.T) {
+	var rec recordingRenderer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(strings.NewReader("ab\x1bhix\x1bh\r"), &rec)
+	i.EditMode = EditModeVi
+	i.ViModeIndicator = ViIndicatorCursor | ViIndicatorPrompt
+	i.ViNormalPrompt, i.ViInsertPrompt = "[N] ", "[I] "
+
+	line, err := i.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "xab" {
+		t.Fatalf("expected %q, got %q", "xab", line)
+	}
+
+	// a bar while inserting and a block in normal mode, and the terminal's
+	// own shape once the line's been read
+	var shapes, modes []string
+	for _, op := range rec.ops {
+		switch {
+		case strings.HasPrefix(op, "cursor-shape "):
+			shapes = append(shapes, op)
+		case strings.HasPrefix(op, `print "[`):
+			// the mode each time it changes
+			if mode := op[7:10]; len(modes) == 0 || modes[len(modes)-1] != mode {
+				modes = append(modes, mode)
+			}
+		}
+	}
+
+	expect := []string{"cursor-shape 6", "cursor-shape 2", "cursor-shape 6", "cursor-shape 2", "cursor-shape 0"}
+	if !reflect.DeepEqual(shapes, expect) {
+		t.Fatalf("expected %q, got %q", expect, shapes)
+	}
+	if rec.ops[len(rec.ops)-1] != "cursor-shape 0" {
+		t.Fatalf("expected the shape to be put back last, got %q", rec.ops)
+	}
+
+	if expect := []string{"[I]", "[N]", "[I]", "[N]"}; !reflect.DeepEqual(modes, expect) {
+		t.Fatalf("expected the prompt to show %q, got %q", expect, modes)
+	}
+
+	if i.Prompt.first() != ">>> " {
+		t.Fatalf("expected the prompt to be put back, got %q", i.Prompt.first())
+	}
+}
+
+func TestViEscapeAlone(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out syncBuffer
+	i, _ := newTestInstance("")
+	i.Terminal = newTerminal(r, &out)
+	i.EditMode = EditModeVi
+	i.ViModeIndicator = ViIndicatorCursor
+
+	done := make(chan string, 1)
+	go func() {
+		line, _ := i.Readline()
+		done <- line
+	}()
+
+	// normal mode is shown without waiting for another key
+	w.Write([]byte("ab\x1b"))
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), CursorBlock) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected normal mode after escape alone, got %q", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w.Write([]byte("x\r"))
+	if line := <-done; line != "a" {
+		t.Fatalf("expected %q, got %q", "a", line)
+	}
+}
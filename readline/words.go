@@ -0,0 +1,131 @@
+package readline
+
+import (
+	"unicode"
+)
+
+// wordClass sorts runes for finding where words start and end.
+type wordClass int
+
+const (
+	wordNone wordClass = iota // spaces, and punctuation with UnicodeWords
+	wordLetter
+	wordKatakana
+	// wordIdeograph is Han and Hiragana, where each rune is a word of its own
+	wordIdeograph
+)
+
+// classify returns the class of r on its own for UnicodeWords.
+func classify(r rune) wordClass {
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hiragana):
+		return wordIdeograph
+	case unicode.In(r, unicode.Katakana) || r == 'ー':
+		return wordKatakana
+	case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r), r == '_':
+		return wordLetter
+	}
+	return wordNone
+}
+
+// wordAt returns the class of the rune at pos. Without UnicodeWords anything
+// but a space is part of a word. With it, words are broken between scripts
+// and at punctuation, roughly as in UAX #29, although an apostrophe or a full
+// stop between letters or digits, as in "don't" and "3.14", is kept in the
+// word.
+func (b *Buffer) wordAt(pos int) wordClass {
+	r := b.runeAt(pos)
+	if !b.UnicodeWords {
+		if unicode.IsSpace(r) {
+			return wordNone
+		}
+		return wordLetter
+	}
+
+	c := classify(r)
+	if c == wordNone && (r == '\'' || r == '’' || r == '.') && pos > 0 && pos < b.Size()-1 {
+		if classify(b.runeAt(pos-1)) == wordLetter && classify(b.runeAt(pos+1)) == wordLetter {
+			return wordLetter
+		}
+	}
+	return c
+}
+
+// prevWord returns where the nth word before the cursor starts, skipping
+// anything that isn't part of a word in between.
+func (b *Buffer) prevWord(n int) int {
+	pos := b.Pos
+	for cnt := 0; cnt < n; cnt++ {
+		for pos > 0 && b.wordAt(pos-1) == wordNone {
+			pos -= 1
+		}
+		if pos == 0 {
+			break
+		}
+
+		c := b.wordAt(pos - 1)
+		pos -= 1
+		for c != wordIdeograph && pos > 0 && b.wordAt(pos-1) == c {
+			pos -= 1
+		}
+	}
+	return pos
+}
+
+// nextWord returns where the nth word after the cursor ends, skipping
+// anything that isn't part of a word in between.
+func (b *Buffer) nextWord(n int) int {
+	pos := b.Pos
+	for cnt := 0; cnt < n; cnt++ {
+		for pos < b.Size() && b.wordAt(pos) == wordNone {
+			pos += 1
+		}
+		if pos == b.Size() {
+			break
+		}
+
+		c := b.wordAt(pos)
+		pos += 1
+		for c != wordIdeograph && pos < b.Size() && b.wordAt(pos) == c {
+			pos += 1
+		}
+	}
+	return pos
+}
+
+// wordUnder returns where the word under the cursor starts and ends, or the
+// one just before it when the cursor is right after a word. Both are the
+// cursor when there's no word there.
+func (b *Buffer) wordUnder() (int, int) {
+	pos := b.Pos
+	if pos == b.Size() || b.wordAt(pos) == wordNone {
+		if pos == 0 || b.wordAt(pos-1) == wordNone {
+			return b.Pos, b.Pos
+		}
+		pos -= 1
+	}
+
+	c := b.wordAt(pos)
+	if c == wordIdeograph {
+		return pos, pos + 1
+	}
+
+	start, end := pos, pos+1
+	for start > 0 && b.wordAt(start-1) == c {
+		start -= 1
+	}
+	for end < b.Size() && b.wordAt(end) == c {
+		end += 1
+	}
+	return start, end
+}
+
+// ReplaceWord replaces the word under the cursor with text, leaving the
+// cursor after it, and returns the word that was removed. Without a word
+// there text is just inserted.
+func (b *Buffer) ReplaceWord(text string) []rune {
+	start, end := b.wordUnder()
+	word := b.cut(start, end)
+	b.AddString(text)
+	return word
+}
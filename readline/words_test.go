@@ -0,0 +1,116 @@
+package readline
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestWordBoundaries(t *testing.T) {
+	type testCase struct {
+		text    string
+		unicode bool
+		starts  []int // where Meta-B stops, going back from the end
+		ends    []int // where Meta-F stops, going on from the start
+	}
+
+	testCases := map[string]*testCase{
+		"spaces":          {"hello, world", false, []int{7, 0}, []int{6, 12}},
+		"spaces mixed":    {"abc漢字def", false, []int{0}, []int{8}},
+		"punctuation":     {"hello, world", true, []int{7, 0}, []int{5, 12}},
+		"path":            {"cd /usr/local", true, []int{8, 4, 0}, []int{2, 7, 13}},
+		"latin and han":   {"abc漢字def", true, []int{5, 4, 3, 0}, []int{3, 4, 5, 8}},
+		"katakana":        {"カタカナ漢字", true, []int{5, 4, 0}, []int{4, 5, 6}},
+		"hiragana":        {"ひらがな", true, []int{3, 2, 1, 0}, []int{1, 2, 3, 4}},
+		"apostrophe":      {"don't stop", true, []int{6, 0}, []int{5, 10}},
+		"decimal":         {"pi=3.14", true, []int{3, 0}, []int{2, 7}},
+		"full stop":       {"end.", true, []int{0}, []int{3, 4}},
+		"cjk punctuation": {"你好，世界。", true, []int{4, 3, 1, 0}, []int{1, 2, 4, 5, 6}},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+			b.out = io.Discard
+			b.UnicodeWords = v.unicode
+			b.AddString(v.text)
+
+			var starts []int
+			for b.Pos > 0 {
+				b.MoveLeftWord()
+				starts = append(starts, b.Pos)
+			}
+			if !reflect.DeepEqual(starts, v.starts) {
+				t.Fatalf("expected starts %v, got %v", v.starts, starts)
+			}
+
+			var ends []int
+			for b.Pos < b.Size() {
+				b.MoveRightWord()
+				ends = append(ends, b.Pos)
+			}
+			if !reflect.DeepEqual(ends, v.ends) {
+				t.Fatalf("expected ends %v, got %v", v.ends, ends)
+			}
+		})
+	}
+}
+
+func TestUnicodeWords(t *testing.T) {
+	testCases := map[string]string{
+		"cd /usr/local\x17\r":     "cd /usr/",
+		"abc漢字def\x17\x17\r":      "abc漢",
+		"你好，世界\x1b\x7f\x1b\x7f\r": "你好，",
+		"don't stop\x01\x1bd\r":   " stop",
+		"x=foo.bar\x1bbX\r":       "x=Xfoo.bar",
+	}
+
+	for input, expect := range testCases {
+		i, _ := newTestInstance(input)
+		i.UnicodeWords = true
+
+		line, err := i.Readline()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != expect {
+			t.Errorf("%q: expected %q, got %q", input, expect, line)
+		}
+	}
+}
+
+func TestReplaceWord(t *testing.T) {
+	type testCase struct {
+		pos     int
+		expect  string
+		removed string
+	}
+
+	testCases := map[string]*testCase{
+		"start of word":  {4, "one TWO three", "two"},
+		"middle of word": {5, "one TWO three", "two"},
+		"after word":     {7, "one TWO three", "two"},
+		"first word":     {0, "TWO two three", "one"},
+		"last word":      {13, "one two TWO", "three"},
+	}
+
+	for k, v := range testCases {
+		t.Run(k, func(t *testing.T) {
+			b, _ := NewBuffer(&Prompt{Prompt: ">>> "})
+			b.out = io.Discard
+			b.AddString("one two three")
+			for b.Pos > v.pos {
+				b.MoveLeft()
+			}
+
+			removed := b.ReplaceWord("TWO")
+			if b.String() != v.expect {
+				t.Fatalf("expected %q, got %q", v.expect, b.String())
+			}
+			if string(removed) != v.removed {
+				t.Fatalf("expected to remove %q, got %q", v.removed, string(removed))
+			}
+		})
+	}
+}